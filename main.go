@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/armadi1809/vaulta/config"
@@ -11,83 +16,521 @@ import (
 )
 
 type Init struct {
+	KDFFlags   `embed:""`
+	NoPassword bool   `name:"no-password" help:"Unlock the vault with the keyfile alone, requires --keyfile."`
+	Cipher     string `enum:"aes-256-gcm,xchacha20-poly1305" default:"aes-256-gcm" help:"Cipher to encrypt the vault with: ${enum}."`
+}
+
+// KDFFlags are the Argon2id parameters accepted by init and kdf upgrade.
+type KDFFlags struct {
+	KDFTime    uint32 `name:"kdf-time" default:"3" help:"Argon2id passes over memory."`
+	KDFMemory  uint32 `name:"kdf-memory" default:"64" help:"Argon2id memory in MiB."`
+	KDFThreads uint8  `name:"kdf-threads" default:"2" help:"Argon2id parallelism."`
+}
+
+// GenerateFlags are the secret generator options accepted by generate and
+// add --generate.
+type GenerateFlags struct {
+	Length           int    `default:"20" help:"Number of characters of a generated password."`
+	Lower            bool   `default:"true" negatable:"" help:"Use lowercase letters."`
+	Upper            bool   `default:"true" negatable:"" help:"Use uppercase letters."`
+	Digits           bool   `default:"true" negatable:"" help:"Use digits."`
+	Symbols          bool   `default:"true" negatable:"" help:"Use symbols."`
+	ExcludeAmbiguous bool   `name:"exclude-ambiguous" help:"Leave out characters that look alike, such as l, 1 and I."`
+	Words            int    `help:"Generate a passphrase of this many words, at least 5, instead of a password. Each word adds about 12.9 bits of entropy."`
+	Separator        string `default:"-" help:"Separator between the words of a passphrase."`
+}
+
+func (g GenerateFlags) options() vault.GenerateOptions {
+	return vault.GenerateOptions{
+		Length:           g.Length,
+		Lower:            g.Lower,
+		Upper:            g.Upper,
+		Digits:           g.Digits,
+		Symbols:          g.Symbols,
+		ExcludeAmbiguous: g.ExcludeAmbiguous,
+		Words:            g.Words,
+		Separator:        g.Separator,
+	}
+}
+
+func (k KDFFlags) params() vault.KDFParams {
+	return vault.KDFParams{Time: k.KDFTime, Memory: k.KDFMemory * 1024, Threads: k.KDFThreads}
+}
+
+type KDF struct {
+	Show      KDFShow      `cmd:"" help:"Show the key derivation parameters of the vault."`
+	Calibrate KDFCalibrate `cmd:"" help:"Benchmark this machine to pick key derivation parameters."`
+	Upgrade   KDFUpgrade   `cmd:"" help:"Re-wrap the vault key with new key derivation parameters."`
+}
+
+type KDFShow struct {
+}
+
+type KDFCalibrate struct {
+	Target    time.Duration `default:"1s" help:"Target time to unlock the vault."`
+	MaxMemory uint32        `name:"max-memory" default:"256" help:"Largest amount of memory to use, in MiB."`
+	Apply     bool          `help:"Re-wrap the vault key with the calibrated parameters."`
+}
+
+type KDFUpgrade struct {
+	KDFFlags `embed:""`
+}
+
+type KeySlot struct {
+	List   KeySlotList   `cmd:"" help:"List the key slots of the vault."`
+	Add    KeySlotAdd    `cmd:"" help:"Add a password that can also unlock the vault."`
+	Remove KeySlotRemove `cmd:"" help:"Remove a key slot."`
+}
+
+type KeySlotList struct {
+}
+
+type KeySlotAdd struct {
+	NewKeyfile string `name:"new-keyfile" type:"existingfile" help:"Keyfile needed to unlock with the new key slot." placeholder:"PATH"`
+	NoPassword bool   `name:"no-password" help:"Unlock with the new keyfile alone, requires --new-keyfile."`
+}
+
+type KeySlotRemove struct {
+	ID int `arg:"" name:"id" help:"ID of the key slot to remove, as shown by keyslot list."`
+}
+
+type Keyfile struct {
+	Generate KeyfileGenerate `cmd:"" help:"Write a new random keyfile."`
+}
+
+type KeyfileGenerate struct {
+	Path string `arg:"" name:"path" help:"Where to write the keyfile." type:"path"`
+}
+
+type Recovery struct {
+	Generate RecoveryGenerate `cmd:"" help:"Create a recovery key that can unlock the vault if the master password is lost."`
+	Unlock   RecoveryUnlock   `cmd:"" help:"Unlock the vault with the recovery key and choose a new master password."`
+}
+
+type RecoveryGenerate struct {
+	Kit string `help:"Also write the emergency kit, a printable text document, to this file." type:"path" placeholder:"PATH"`
+}
+
+type RecoveryUnlock struct {
+}
+
+type Escrow struct {
+	Split   EscrowSplit   `cmd:"" help:"Add a key slot unlocked by a new escrow key and split that key into shares, a threshold of which unlock the vault. Any previous escrow slot is replaced."`
+	Combine EscrowCombine `cmd:"" help:"Unlock the vault with escrow shares, and with --reset choose a new master password."`
+}
+
+type EscrowSplit struct {
+	Shares    int `required:"" help:"Number of shares to create."`
+	Threshold int `required:"" help:"Number of shares needed to unlock the vault."`
+}
+
+type EscrowCombine struct {
+	Reset bool `help:"Choose a new master password once the shares unlock the vault."`
 }
 
 type List struct {
+	Tag  []string `help:"Only list entries with this tag. May be repeated to require several tags."`
+	Sort string   `enum:"name,created,modified,accessed" default:"name" help:"Sort order: ${enum}. Dates sort the most recent first."`
+}
+
+type Search struct {
+	Query []string `arg:"" name:"query" help:"Words to look for in entry names, usernames, URLs, tags and notes."`
 }
 
 type Add struct {
+	Name        string   `arg:"" optional:"" name:"name" help:"Name of the entry. Prompted for when omitted." type:"string"`
+	Username    string   `short:"u" help:"Username or description of the secret."`
+	SecretStdin bool     `name:"secret-stdin" help:"Read the secret from standard input instead of prompting." xor:"secret"`
+	Generate    bool     `short:"g" help:"Store a newly generated secret instead of prompting." xor:"secret"`
+	URL         []string `name:"url" help:"URL the entry belongs to. May be repeated."`
+	Notes       string   `help:"Free-form notes for the entry."`
+	Tag         []string `help:"Tag to attach to the entry. May be repeated."`
+	Field       []string `help:"Custom field as name=value or name:type=value, with type one of text, hidden, url, email. May be repeated." sep:"none" placeholder:"NAME[:TYPE]=VALUE"`
+	TOTP        string   `name:"totp" help:"TOTP secret in base32 or as an otpauth:// URI, to generate one-time passwords with the otp command."`
+	Force       bool     `short:"f" help:"Replace an existing entry with the same name without asking." xor:"clobber"`
+	NoClobber   bool     `name:"no-clobber" help:"Fail instead of replacing an existing entry with the same name." xor:"clobber"`
+
+	GenerateFlags `embed:""`
 }
 
 type Get struct {
-	Entry string `arg:"" name:"entry" help:"Entry to get from the vault." type:"string"`
+	Entry      string        `arg:"" name:"entry" help:"Entry to get from the vault." type:"string"`
+	Show       bool          `help:"Show the password and hidden fields instead of masking them."`
+	Copy       bool          `short:"c" help:"Copy a field to the clipboard instead of printing the entry."`
+	Field      string        `default:"password" help:"Field to copy: username, password, urls, notes, tags or the name of a custom field."`
+	ClearAfter time.Duration `name:"clear-after" default:"45s" help:"Clear the copied field from the clipboard after this long, 0 to leave it."`
+}
+
+type OTP struct {
+	Entry      string        `arg:"" name:"entry" help:"Entry to generate a one-time password for." type:"string"`
+	Copy       bool          `short:"c" help:"Copy the one-time password to the clipboard instead of printing it."`
+	ClearAfter time.Duration `name:"clear-after" default:"45s" help:"Clear the copied one-time password from the clipboard after this long, 0 to leave it."`
+}
+
+type Tui struct {
+	IdleTimeout time.Duration `name:"idle-timeout" default:"5m" help:"Lock the vault and close the browser after this long without a key press, 0 to never lock."`
+	ClearAfter  time.Duration `name:"clear-after" default:"45s" help:"Clear copied values from the clipboard after this long, 0 to leave them."`
+}
+
+type Edit struct {
+	Entry string   `arg:"" name:"entry" help:"Entry to edit." type:"string"`
+	Set   []string `help:"Set a field without prompting, as field=value. Fields: username, password, urls, notes, tags, totp, or field.<name>[:<type>] for custom fields. May be repeated." sep:"none" placeholder:"FIELD=VALUE"`
+}
+
+type History struct {
+	Entry string `arg:"" name:"entry" help:"Entry to show the history of." type:"string"`
+}
+
+type Restore struct {
+	Entry   string `arg:"" name:"entry" help:"Entry to restore." type:"string"`
+	Version int    `short:"v" required:"" help:"Version to restore, as numbered by the history command."`
+}
+
+type Retention struct {
+	Versions   *int `help:"Number of previous versions to keep per entry."`
+	MaxAgeDays *int `name:"max-age-days" help:"Drop previous versions older than this many days, 0 keeps them regardless of age."`
 }
 
 type Delete struct {
 	Entry string `arg:"" name:"entry" help:"Entry to delete from the vault." type:"string"`
 }
 
+type Passwd struct {
+}
+
+type Generate struct {
+	GenerateFlags `embed:""`
+}
+
 type Reset struct {
 }
 
-func (i *Init) Run(vault *vault.Vault) error {
-	return vault.InitVault()
+func (i *Init) Run(v *vault.Vault) error {
+	if err := i.params().Validate(); err != nil {
+		return err
+	}
+	return v.InitVault(i.NoPassword, vault.WithKDFParams(i.params()), vault.WithCipher(i.Cipher))
+}
+
+func (k *KDFShow) Run(vault *vault.Vault) error {
+	err := vault.ShowKDF()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to show key derivation parameters: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (k *KDFCalibrate) Run(vault *vault.Vault) error {
+	err := vault.CalibrateKDF(k.Target, k.MaxMemory*1024, k.Apply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to calibrate key derivation: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (k *KDFUpgrade) Run(vault *vault.Vault) error {
+	err := vault.UpgradeKDF(k.params())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to upgrade key derivation: %v", err)))
+		os.Exit(1)
+	}
+	return nil
 }
 
-func (l *List) Run(vault *vault.Vault) error {
-	res, err := vault.ListEntries()
+func (k *KeySlotList) Run(vault *vault.Vault) error {
+	res, err := vault.ListKeySlots()
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to list entries: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to list key slots: %v", err)))
 		os.Exit(1)
 	}
 	fmt.Println(res)
 	return nil
 }
 
-func (a *Add) Run() error {
-	err := vault.AddEntry()
+func (k *KeySlotAdd) Run(vault *vault.Vault) error {
+	err := vault.AddKeySlot(k.NewKeyfile, k.NoPassword)
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to add entry: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to add key slot: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (k *KeySlotRemove) Run(vault *vault.Vault) error {
+	err := vault.RemoveKeySlot(k.ID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to remove key slot: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (k *KeyfileGenerate) Run(vault *vault.Vault) error {
+	err := vault.GenerateKeyfile(k.Path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to generate keyfile: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (r *RecoveryGenerate) Run(vault *vault.Vault) error {
+	res, err := vault.GenerateRecoveryKey(r.Kit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to generate recovery key: %v", err)))
+		os.Exit(1)
+	}
+	if res != "" {
+		fmt.Println(res)
+	}
+	return nil
+}
+
+func (r *RecoveryUnlock) Run(vault *vault.Vault) error {
+	err := vault.RecoveryUnlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to recover vault: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (e *EscrowSplit) Run(vault *vault.Vault) error {
+	res, err := vault.SplitEscrow(e.Shares, e.Threshold)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to split escrow key: %v", err)))
+		os.Exit(1)
+	}
+	if res != "" {
+		fmt.Println(res)
+	}
+	return nil
+}
+
+func (e *EscrowCombine) Run(vault *vault.Vault) error {
+	err := vault.CombineEscrow(e.Reset)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to combine escrow shares: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (l *List) Run(v *vault.Vault) error {
+	res, err := v.ListEntries(vault.ListOptions{Tags: l.Tag, Sort: l.Sort})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to list entries: %v", err)))
+		os.Exit(1)
+	}
+	fmt.Println(res)
+	return nil
+}
+
+func (s *Search) Run(vault *vault.Vault) error {
+	res, err := vault.SearchEntries(strings.Join(s.Query, " "))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to search entries: %v", err)))
+		os.Exit(1)
+	}
+	fmt.Println(res)
+	return nil
+}
+
+func (a *Add) Run(v *vault.Vault) error {
+	opts := vault.AddOptions{
+		Name:      a.Name,
+		Username:  a.Username,
+		URLs:      a.URL,
+		Notes:     a.Notes,
+		Tags:      a.Tag,
+		TOTP:      a.TOTP,
+		Force:     a.Force,
+		NoClobber: a.NoClobber,
+	}
+	if a.Generate {
+		generate := a.GenerateFlags.options()
+		opts.Generate = &generate
+	}
+	for _, f := range a.Field {
+		field, err := vault.ParseField(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to add entry: %v", err)))
+			os.Exit(1)
+		}
+		opts.Fields = append(opts.Fields, field)
+	}
+	if a.SecretStdin {
+		secret, err := readSecret(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to read secret: %v", err)))
+			os.Exit(1)
+		}
+		opts.Secret = secret
+	}
+	err := v.AddEntry(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to add entry: %v", err)))
 		os.Exit(1)
 	}
 	return nil
 }
 
 func (g *Get) Run(vault *vault.Vault) error {
-	res, err := vault.GetEntry(g.Entry)
+	if g.Copy {
+		if err := vault.CopyEntry(g.Entry, g.Field, g.ClearAfter); err != nil {
+			fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to copy entry: %v", err)))
+			os.Exit(1)
+		}
+		return nil
+	}
+	res, err := vault.GetEntry(g.Entry, g.Show)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to get entry: %v", err)))
+		os.Exit(1)
+	}
+	fmt.Println(res)
+	return nil
+}
+
+func (o *OTP) Run(vault *vault.Vault) error {
+	res, err := vault.OTP(o.Entry, o.Copy, o.ClearAfter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to generate one-time password: %v", err)))
+		os.Exit(1)
+	}
+	if res != "" {
+		fmt.Println(res)
+	}
+	return nil
+}
+
+func (t *Tui) Run(vault *vault.Vault) error {
+	err := vault.Browse(t.IdleTimeout, t.ClearAfter)
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to get entry: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to browse vault: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (e *Edit) Run(vault *vault.Vault) error {
+	err := vault.EditEntry(e.Entry, e.Set)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to edit entry: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (h *History) Run(vault *vault.Vault) error {
+	res, err := vault.EntryHistory(h.Entry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to get entry history: %v", err)))
 		os.Exit(1)
 	}
 	fmt.Println(res)
 	return nil
 }
 
+func (r *Restore) Run(vault *vault.Vault) error {
+	err := vault.RestoreEntry(r.Entry, r.Version)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to restore entry: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (r *Retention) Run(vault *vault.Vault) error {
+	err := vault.ConfigureRetention(r.Versions, r.MaxAgeDays)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to configure retention: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
 func (d *Delete) Run(vault *vault.Vault) error {
 	err := vault.DeleteEntry(d.Entry)
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to delete entry: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to delete entry: %v", err)))
 		os.Exit(1)
 	}
 	return nil
 }
 
+func (p *Passwd) Run(vault *vault.Vault) error {
+	err := vault.ChangePassword()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to change master password: %v", err)))
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (g *Generate) Run(vault *vault.Vault) error {
+	res, err := vault.GenerateSecret(g.GenerateFlags.options())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to generate secret: %v", err)))
+		os.Exit(1)
+	}
+	fmt.Println(res)
+	return nil
+}
+
 func (r *Reset) Run(vault *vault.Vault) error {
 	err := vault.ResetEntry()
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to reset vault: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to reset vault: %v", err)))
 		os.Exit(1)
 	}
 	return nil
 }
 
+// readSecret reads a secret from r, dropping a single trailing newline
+func readSecret(r io.Reader) ([]byte, error) {
+	secret, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	secret = bytes.TrimSuffix(secret, []byte("\n"))
+	secret = bytes.TrimSuffix(secret, []byte("\r"))
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+	return secret, nil
+}
+
 var cli struct {
-	Init   Init   `cmd:"" help:"Initialize the vault."`
-	List   List   `cmd:"" help:"List entries in the vault."`
-	Get    Get    `cmd:"" help:"Get an entry in the vault."`
-	Add    Add    `cmd:"" help:"Add an entry to the vault."`
-	Delete Delete `cmd:"" help:"Delete an entry from the vault."`
-	Reset  Reset  `cmd:"" help:"Reset vault"`
+	PasswordFD   *int   `name:"password-fd" help:"Read the master password from this open file descriptor." xor:"password" placeholder:"FD"`
+	PasswordFile string `name:"password-file" help:"Read the master password from a file only readable by you." xor:"password" type:"path" placeholder:"PATH"`
+	PasswordEnv  bool   `name:"password-env" help:"Read the master password from the VAULTA_MASTER_PASSWORD environment variable." xor:"password"`
+	KeyfilePath  string `name:"keyfile" help:"Keyfile to unlock the vault with, along with or instead of the master password." type:"existingfile" placeholder:"PATH"`
+	Output       string `short:"o" enum:"text,json,yaml,raw" default:"text" help:"Output format for results: ${enum}."`
+
+	Init      Init      `cmd:"" help:"Initialize the vault."`
+	Tui       Tui       `cmd:"" name:"tui" default:"withargs" help:"Browse and edit entries in a full-screen interface. Runs when no command is given."`
+	List      List      `cmd:"" help:"List entries in the vault."`
+	Search    Search    `cmd:"" help:"Search entries by name, username, URL, tag or notes."`
+	Get       Get       `cmd:"" help:"Get an entry in the vault."`
+	OTP       OTP       `cmd:"" name:"otp" help:"Show the current one-time password of an entry."`
+	Add       Add       `cmd:"" help:"Add an entry to the vault."`
+	Edit      Edit      `cmd:"" help:"Edit an entry in the vault."`
+	Delete    Delete    `cmd:"" help:"Delete an entry from the vault."`
+	History   History   `cmd:"" help:"Show previous versions of an entry."`
+	Restore   Restore   `cmd:"" help:"Restore a previous version of an entry."`
+	Retention Retention `cmd:"" help:"Show or change how many previous versions are kept."`
+	Passwd    Passwd    `cmd:"" help:"Change the master password."`
+	Generate  Generate  `cmd:"" help:"Generate a random password or passphrase."`
+	Reset     Reset     `cmd:"" help:"Reset vault"`
+	KDF       KDF       `cmd:"" name:"kdf" help:"Inspect and tune key derivation."`
+	KeySlot   KeySlot   `cmd:"" name:"keyslot" help:"Manage the ways the vault can be unlocked."`
+	Keyfile   Keyfile   `cmd:"" help:"Manage keyfiles."`
+	Recovery  Recovery  `cmd:"" help:"Recover a vault whose master password is lost."`
+	Escrow    Escrow    `cmd:"" help:"Share the vault key between several people for break-glass access."`
 }
 
 func main() {
@@ -98,12 +541,29 @@ func main() {
 	)
 	vaultPath, err := config.DefaultVaultPath()
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to get vault path: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to get vault path: %v", err)))
 		os.Exit(1)
 	}
-	v, err := vault.New(vaultPath)
+	opts := []vault.Option{vault.WithOutputFormat(vault.Format(cli.Output))}
+	switch {
+	case cli.PasswordFD != nil:
+		opts = append(opts, vault.WithPasswordSource(vault.PasswordFromFD(*cli.PasswordFD)))
+	case cli.PasswordFile != "":
+		opts = append(opts, vault.WithPasswordSource(vault.PasswordFromFile(cli.PasswordFile)))
+	case cli.PasswordEnv:
+		fmt.Fprintln(os.Stderr, ui.RenderWarning("Reading the master password from "+vault.MasterPasswordEnv+". Environment variables can leak through process listings and logs, prefer --password-fd or --password-file."))
+		opts = append(opts, vault.WithPasswordSource(vault.PasswordFromEnv()))
+	default:
+		if _, ok := os.LookupEnv(vault.MasterPasswordEnv); ok {
+			fmt.Fprintln(os.Stderr, ui.RenderWarning(vault.MasterPasswordEnv+" is set but ignored, pass --password-env to use it."))
+		}
+	}
+	if cli.KeyfilePath != "" {
+		opts = append(opts, vault.WithKeyfile(cli.KeyfilePath))
+	}
+	v, err := vault.New(vaultPath, opts...)
 	if err != nil {
-		fmt.Println(ui.RenderError(fmt.Sprintf("Failed to initialize vault: %v", err)))
+		fmt.Fprintln(os.Stderr, ui.RenderError(fmt.Sprintf("Failed to initialize vault: %v", err)))
 		os.Exit(1)
 	}
 	err = ctx.Run(v)
@@ -0,0 +1,168 @@
+// Package qrcode encodes short text as a QR code, so secrets such as recovery
+// keys can be scanned from the terminal or a printed page.
+package qrcode
+
+import (
+	"errors"
+)
+
+// ErrTooLong is returned when the text does not fit in the largest supported
+// symbol.
+var ErrTooLong = errors.New("text too long for a QR code")
+
+// version describes the error correction blocks of a QR code version at the
+// medium (M) error correction level
+type version struct {
+	ecPerBlock int
+	// blocks holds the number of data codewords of each block
+	blocks []int
+	// alignment holds the centers of the alignment patterns
+	alignment []int
+}
+
+// versions 1 to 10 at error correction level M, from ISO/IEC 18004 tables 9
+// and E.1
+var versions = []version{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+// dataCodewords returns the number of data codewords the version holds
+func (v version) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// Encode returns the modules of a QR code holding text in byte mode with
+// medium error correction, indexed by row then column, true for dark modules.
+// The quiet zone around the symbol is not included.
+func Encode(text string) ([][]bool, error) {
+	return encode(text, -1)
+}
+
+// encode is Encode with the given mask pattern, or the one with the lowest
+// penalty when mask is negative
+func encode(text string, mask int) ([][]bool, error) {
+	data := []byte(text)
+	ver := 0
+	for n := 1; n < len(versions); n++ {
+		if 4+countBits(n)+8*len(data) <= 8*versions[n].dataCodewords() {
+			ver = n
+			break
+		}
+	}
+	if ver == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := interleave(versions[ver], encodeData(ver, data))
+	s := newSymbol(ver)
+	s.drawFunctionPatterns()
+	s.drawCodewords(codewords)
+
+	if mask < 0 {
+		mask = s.bestMask()
+	}
+	s.applyMask(mask)
+	s.drawFormatBits(mask)
+	return s.modules, nil
+}
+
+// bestMask returns the mask pattern giving the symbol the lowest penalty
+func (s *symbol) bestMask() int {
+	best, bestPenalty := -1, 0
+	for mask := range 8 {
+		s.applyMask(mask)
+		s.drawFormatBits(mask)
+		if p := s.penalty(); best < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		s.applyMask(mask)
+	}
+	return best
+}
+
+// countBits returns the length of the character count in byte mode
+func countBits(ver int) int {
+	if ver < 10 {
+		return 8
+	}
+	return 16
+}
+
+// bitBuffer accumulates bits most significant first
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+// encodeData returns the data codewords of the symbol: the byte mode
+// segment, a terminator and padding up to the capacity of the version
+func encodeData(ver int, data []byte) []byte {
+	capacity := 8 * versions[ver].dataCodewords()
+
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(ver))
+	for _, c := range data {
+		bits.append(int(c), 8)
+	}
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, capacity/8)
+	for i := 0; i < len(bits); i += 8 {
+		var c byte
+		for _, bit := range bits[i : i+8] {
+			c <<= 1
+			if bit {
+				c |= 1
+			}
+		}
+		codewords = append(codewords, c)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// interleave splits data into the error correction blocks of the version,
+// computes their error correction codewords and interleaves them all
+func interleave(v version, data []byte) []byte {
+	var blocks, ecc [][]byte
+	for _, n := range v.blocks {
+		blocks = append(blocks, data[:n])
+		ecc = append(ecc, reedSolomon(data[:n], v.ecPerBlock))
+		data = data[n:]
+	}
+
+	var out []byte
+	for i := range v.blocks[len(v.blocks)-1] {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := range v.ecPerBlock {
+		for _, block := range ecc {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package qrcode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The golden files in testdata hold the symbols rsc.io/qr/coding draws for
+// each text at medium error correction, one per mask pattern in order,
+// separated by blank lines. Rows use # for dark and . for light modules.
+var goldenTests = []struct {
+	name    string
+	version int
+	text    string
+}{
+	{"version1", 1, "vaulta"},
+	{"version2", 2, "otpauth://totp/vaulta"},
+	{"version5", 5, "abandon ability able about above absent absorb abstract absurd abuse access"},
+	{"version7", 7, "otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=Example&period=30&digits=6"},
+	{"version10", 10, strings.Repeat("correct horse battery staple ", 7)},
+}
+
+// readGolden returns the symbols of the golden file name, one per mask
+func readGolden(t *testing.T, name string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name+".golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n\n")
+	if len(symbols) != 8 {
+		t.Fatalf("%s holds %d symbols, want 8", name, len(symbols))
+	}
+	return symbols
+}
+
+// render draws modules like the golden files
+func render(modules [][]bool) string {
+	var b strings.Builder
+	for _, row := range modules {
+		for _, dark := range row {
+			if dark {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func TestEncodeGolden(t *testing.T) {
+	for _, test := range goldenTests {
+		t.Run(test.name, func(t *testing.T) {
+			golden := readGolden(t, test.name)
+			for mask, want := range golden {
+				modules, err := encode(test.text, mask)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size := 17 + 4*test.version; len(modules) != size {
+					t.Fatalf("symbol is %d modules wide, want %d for version %d", len(modules), size, test.version)
+				}
+				if got := render(modules); got != want {
+					t.Errorf("mask %d differs from the golden symbol:\n%s\nwant:\n%s", mask, got, want)
+				}
+			}
+
+			// Encode picks one of the masks
+			modules, err := Encode(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := render(modules)
+			found := false
+			for _, want := range golden {
+				found = found || got == want
+			}
+			if !found {
+				t.Errorf("Encode returned a symbol matching no mask:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	// Version 10 holds 213 bytes at medium error correction
+	if _, err := Encode(strings.Repeat("a", 213)); err != nil {
+		t.Errorf("Encode of 213 bytes: %v", err)
+	}
+	if _, err := Encode(strings.Repeat("a", 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode of 214 bytes returned %v, want %v", err, ErrTooLong)
+	}
+}
@@ -0,0 +1,59 @@
+package qrcode
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(256) with the
+// QR code polynomial x^8 + x^4 + x^3 + x^2 + 1
+var gfExp, gfLog = func() (exp [512]byte, log [256]byte) {
+	x := 1
+	for i := range 255 {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// generator returns the coefficients of (x - a^0)(x - a^1)...(x - a^(n-1)),
+// highest degree first, without the leading 1
+func generator(n int) []byte {
+	poly := make([]byte, n)
+	poly[n-1] = 1
+	root := byte(1)
+	for range n {
+		for j := range poly {
+			poly[j] = gfMul(poly[j], root)
+			if j+1 < len(poly) {
+				poly[j] ^= poly[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return poly
+}
+
+// reedSolomon returns the n error correction codewords of data
+func reedSolomon(data []byte, n int) []byte {
+	gen := generator(n)
+	rem := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for i, g := range gen {
+			rem[i] ^= gfMul(g, factor)
+		}
+	}
+	return rem
+}
@@ -0,0 +1,264 @@
+package qrcode
+
+// symbol is a QR code being drawn. Coordinates are given as x for the column
+// and y for the row.
+type symbol struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newSymbol(ver int) *symbol {
+	size := 17 + 4*ver
+	s := &symbol{version: ver, size: size}
+	s.modules = make([][]bool, size)
+	s.function = make([][]bool, size)
+	for y := range size {
+		s.modules[y] = make([]bool, size)
+		s.function[y] = make([]bool, size)
+	}
+	return s
+}
+
+// set draws a function module, which data and masking never touch
+func (s *symbol) set(x, y int, dark bool) {
+	s.modules[y][x] = dark
+	s.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns, the
+// version information, and reserves the format information area
+func (s *symbol) drawFunctionPatterns() {
+	for i := range s.size {
+		s.set(6, i, i%2 == 0)
+		s.set(i, 6, i%2 == 0)
+	}
+
+	s.drawFinder(3, 3)
+	s.drawFinder(s.size-4, 3)
+	s.drawFinder(3, s.size-4)
+
+	align := versions[s.version].alignment
+	last := len(align) - 1
+	for i, x := range align {
+		for j, y := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			s.drawAlignment(x, y)
+		}
+	}
+
+	// Placeholder, the real format bits are drawn once the mask is chosen
+	s.drawFormatBits(0)
+	s.drawVersionBits()
+}
+
+// drawFinder draws a finder pattern and its separator centered on x, y
+func (s *symbol) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= s.size || yy < 0 || yy >= s.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			s.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern centered on x, y
+func (s *symbol) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			s.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the error correction level and mask,
+// protected by a BCH code
+func (s *symbol) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		s.set(8, i, bit(i))
+	}
+	s.set(8, 7, bit(6))
+	s.set(8, 8, bit(7))
+	s.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		s.set(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		s.set(s.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		s.set(8, s.size-15+i, bit(i))
+	}
+	s.set(8, s.size-8, true)
+}
+
+// drawVersionBits draws both copies of the version information, which only
+// versions 7 and up carry
+func (s *symbol) drawVersionBits() {
+	if s.version < 7 {
+		return
+	}
+	bits := versionBits(s.version)
+	for i := range 18 {
+		dark := bits>>i&1 == 1
+		a, b := s.size-11+i%3, i/3
+		s.set(a, b, dark)
+		s.set(b, a, dark)
+	}
+}
+
+// formatBits returns the 15 format information bits for error correction
+// level M, encoded as 00, and mask
+func formatBits(mask int) int {
+	rem := mask
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (mask<<10 | rem) ^ 0x5412
+}
+
+// versionBits returns the 18 version information bits of ver
+func versionBits(ver int) int {
+	rem := ver
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return ver<<12 | rem
+}
+
+// drawCodewords places the codewords in the two-module wide columns that
+// zigzag from the bottom right corner, skipping function modules
+func (s *symbol) drawCodewords(codewords []byte) {
+	i := 0
+	for right := s.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range s.size {
+			y := vert
+			if upward {
+				y = s.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if s.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				s.modules[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by mask. Applying the same mask
+// twice undoes it.
+func (s *symbol) applyMask(mask int) {
+	for y := range s.size {
+		for x := range s.size {
+			if s.function[y][x] {
+				continue
+			}
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			s.modules[y][x] = s.modules[y][x] != flip
+		}
+	}
+}
+
+// penalty scores the symbol with the four rules used to pick a mask: long
+// runs, 2x2 blocks, finder-like patterns and an unbalanced dark ratio
+func (s *symbol) penalty() int {
+	p := 0
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return s.modules[x][y]
+		}
+		return s.modules[y][x]
+	}
+
+	for _, transpose := range []bool{false, true} {
+		for y := range s.size {
+			run := 1
+			for x := 1; x <= s.size; x++ {
+				if x < s.size && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+
+			for x := 0; x+11 <= s.size; x++ {
+				var line [11]bool
+				for i := range line {
+					line[i] = at(x+i, y, transpose)
+				}
+				if line == finderLike || line == finderLikeReversed {
+					p += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range s.size {
+		for x := range s.size {
+			if s.modules[y][x] {
+				dark++
+			}
+			if x+1 < s.size && y+1 < s.size {
+				c := s.modules[y][x]
+				if c == s.modules[y][x+1] && c == s.modules[y+1][x] && c == s.modules[y+1][x+1] {
+					p += 3
+				}
+			}
+		}
+	}
+	total := s.size * s.size
+	p += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return p
+}
+
+var (
+	finderLike         = [11]bool{true, false, true, true, true, false, true, false, false, false, false}
+	finderLikeReversed = [11]bool{false, false, false, false, true, false, true, true, true, false, true}
+)
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
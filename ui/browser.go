@@ -0,0 +1,648 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// browserMask is shown in place of secrets until they are revealed
+const browserMask = "••••••••"
+
+// BrowserEntry is an entry shown by the browser. Lists are comma separated,
+// as they are typed in the edit form.
+type BrowserEntry struct {
+	Name     string
+	Username string
+	Password string
+	URLs     string
+	Notes    string
+	Tags     string
+	// Extra holds the other rows of the detail pane, such as custom fields.
+	Extra []BrowserRow
+}
+
+// BrowserRow is a labelled value of the detail pane. Secret values are
+// masked until revealed.
+type BrowserRow struct {
+	Label  string
+	Value  string
+	Secret bool
+}
+
+// BrowserStore gives the browser access to an unlocked vault. Changes are
+// saved right away.
+type BrowserStore interface {
+	// Entries returns the entries matching query, best matches first, or all
+	// of them by name when query is empty.
+	Entries(query string) ([]BrowserEntry, error)
+	// Put stores entry, replacing the one called oldName, which is empty
+	// for a new entry. Fields the browser does not edit are kept.
+	Put(oldName string, entry BrowserEntry) error
+	// Delete removes the entry called name.
+	Delete(name string) error
+	// Copy puts value on the clipboard.
+	Copy(value string) error
+	// ClearClipboard empties the clipboard if it still holds value.
+	ClearClipboard(value string) error
+	// Lock wipes the decrypted vault from memory. The store is unusable
+	// afterwards.
+	Lock()
+}
+
+// BrowserOptions configures the browser.
+type BrowserOptions struct {
+	// IdleTimeout locks the vault and closes the browser after this long
+	// without a key press, 0 to never lock.
+	IdleTimeout time.Duration
+	// ClearAfter clears copied values from the clipboard after this long, 0
+	// to leave them.
+	ClearAfter time.Duration
+}
+
+// ErrBrowserLocked is returned by RunBrowser when the browser closed because
+// it was idle for too long.
+var ErrBrowserLocked = errors.New("vault locked after a period of inactivity")
+
+type browserMode int
+
+const (
+	browseList browserMode = iota
+	browseFilter
+	browseForm
+	browseConfirmDelete
+)
+
+// browserTick drives the idle timer and refreshes the entries
+type browserTick time.Time
+
+// clipboardExpired asks to clear the value copied with the same sequence
+type clipboardExpired struct {
+	seq int
+}
+
+// formLabels are the fields of the edit form, in order
+var formLabels = []string{"Name", "Username", "Password", "URLs", "Notes", "Tags"}
+
+const formPassword = 2
+
+// Browser is a full-screen Bubble Tea model to browse and edit the entries of
+// a BrowserStore.
+type Browser struct {
+	store   BrowserStore
+	opts    BrowserOptions
+	entries []BrowserEntry
+	cursor  int
+	offset  int
+	filter  textinput.Model
+	mode    browserMode
+
+	revealed bool
+	// editing is the name of the entry in the form, empty when adding one
+	editing  string
+	inputs   []textinput.Model
+	focus    int
+	status   string
+	statusOK bool
+
+	width, height int
+	lastActive    time.Time
+	locked        bool
+
+	// copied is the value on the clipboard waiting to be cleared
+	copied  string
+	copySeq int
+}
+
+// NewBrowser returns a browser over store.
+func NewBrowser(store BrowserStore, opts BrowserOptions) *Browser {
+	filter := textinput.New()
+	filter.Prompt = IconSearch + " "
+	filter.Placeholder = "press / to filter"
+	filter.Width = 30
+	filter.PromptStyle = InputPromptStyle
+	filter.TextStyle = InputStyle
+	filter.Cursor.Style = CursorStyle
+
+	return &Browser{store: store, opts: opts, filter: filter, lastActive: time.Now()}
+}
+
+// RunBrowser runs the browser full screen until the user quits. It returns
+// ErrBrowserLocked if the browser locked the vault after being idle.
+func RunBrowser(store BrowserStore, opts BrowserOptions) error {
+	b := NewBrowser(store, opts)
+	if err := b.reload(); err != nil {
+		return err
+	}
+	m, err := tea.NewProgram(b, tea.WithAltScreen()).Run()
+	if err != nil {
+		return err
+	}
+	if m.(*Browser).locked {
+		return ErrBrowserLocked
+	}
+	return nil
+}
+
+func (b *Browser) Init() tea.Cmd {
+	return tick()
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return browserTick(t) })
+}
+
+func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		b.width, b.height = msg.Width, msg.Height
+		b.scroll()
+		return b, nil
+	case browserTick:
+		if b.opts.IdleTimeout > 0 && time.Since(b.lastActive) >= b.opts.IdleTimeout {
+			return b, b.lock()
+		}
+		// Refresh the entries, which also renews TOTP codes
+		if b.mode == browseList {
+			b.reloadStatus()
+		}
+		return b, tick()
+	case clipboardExpired:
+		if msg.seq == b.copySeq {
+			b.clearClipboard()
+		}
+		return b, nil
+	case tea.KeyMsg:
+		b.lastActive = time.Now()
+		if msg.Type == tea.KeyCtrlC {
+			return b, b.quit()
+		}
+		switch b.mode {
+		case browseFilter:
+			return b.updateFilter(msg)
+		case browseForm:
+			return b.updateForm(msg)
+		case browseConfirmDelete:
+			return b.updateConfirmDelete(msg)
+		default:
+			return b.updateList(msg)
+		}
+	}
+	return b, nil
+}
+
+func (b *Browser) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return b, b.quit()
+	case "up", "k":
+		b.move(-1)
+	case "down", "j":
+		b.move(1)
+	case "pgup":
+		b.move(-b.listHeight())
+	case "pgdown":
+		b.move(b.listHeight())
+	case "home":
+		b.move(-len(b.entries))
+	case "end":
+		b.move(len(b.entries))
+	case "/":
+		b.mode = browseFilter
+		return b, b.filter.Focus()
+	case "esc":
+		if b.filter.Value() != "" {
+			b.filter.SetValue("")
+			b.reloadStatus()
+		}
+	case "r":
+		b.revealed = !b.revealed
+	case "c":
+		if entry, ok := b.selected(); ok {
+			return b, b.copy(entry.Password, "password")
+		}
+	case "u":
+		if entry, ok := b.selected(); ok {
+			return b, b.copy(entry.Username, "username")
+		}
+	case "a":
+		return b, b.openForm(BrowserEntry{}, "")
+	case "e", "enter":
+		if entry, ok := b.selected(); ok {
+			return b, b.openForm(entry, entry.Name)
+		}
+	case "d":
+		if _, ok := b.selected(); ok {
+			b.mode = browseConfirmDelete
+		}
+	}
+	return b, nil
+}
+
+func (b *Browser) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter, tea.KeyDown, tea.KeyUp:
+		b.mode = browseList
+		b.filter.Blur()
+		return b, nil
+	case tea.KeyEsc:
+		b.mode = browseList
+		b.filter.Blur()
+		b.filter.SetValue("")
+		b.reloadStatus()
+		return b, nil
+	}
+	var cmd tea.Cmd
+	query := b.filter.Value()
+	b.filter, cmd = b.filter.Update(msg)
+	if b.filter.Value() != query {
+		b.cursor, b.offset = 0, 0
+		b.reloadStatus()
+	}
+	return b, cmd
+}
+
+func (b *Browser) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	b.mode = browseList
+	entry, ok := b.selected()
+	if !ok || (msg.String() != "y" && msg.String() != "Y") {
+		b.setStatus("Entry unchanged.", true)
+		return b, nil
+	}
+	if err := b.store.Delete(entry.Name); err != nil {
+		b.setStatus(err.Error(), false)
+		return b, nil
+	}
+	b.reloadStatus()
+	b.setStatus(fmt.Sprintf("Entry '%s' deleted.", entry.Name), true)
+	return b, nil
+}
+
+// openForm shows the edit form filled with entry
+func (b *Browser) openForm(entry BrowserEntry, editing string) tea.Cmd {
+	values := []string{entry.Name, entry.Username, entry.Password, entry.URLs, entry.Notes, entry.Tags}
+	b.inputs = make([]textinput.Model, len(formLabels))
+	for i := range b.inputs {
+		input := textinput.New()
+		input.Prompt = ""
+		input.TextStyle = InputStyle
+		input.Cursor.Style = CursorStyle
+		input.SetValue(values[i])
+		if i == formPassword && !b.revealed {
+			input.EchoMode = textinput.EchoPassword
+			input.EchoCharacter = '*'
+		}
+		b.inputs[i] = input
+	}
+	b.editing = editing
+	b.focus = 0
+	b.mode = browseForm
+	return b.inputs[0].Focus()
+}
+
+func (b *Browser) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		b.closeForm()
+		b.setStatus("Entry unchanged.", true)
+		return b, nil
+	case "ctrl+s":
+		return b, b.submitForm()
+	case "enter":
+		if b.focus == len(b.inputs)-1 {
+			return b, b.submitForm()
+		}
+		return b, b.focusInput(b.focus + 1)
+	case "tab", "down":
+		return b, b.focusInput((b.focus + 1) % len(b.inputs))
+	case "shift+tab", "up":
+		return b, b.focusInput((b.focus + len(b.inputs) - 1) % len(b.inputs))
+	case "ctrl+r":
+		b.revealed = !b.revealed
+		if b.revealed {
+			b.inputs[formPassword].EchoMode = textinput.EchoNormal
+		} else {
+			b.inputs[formPassword].EchoMode = textinput.EchoPassword
+		}
+		return b, nil
+	}
+	var cmd tea.Cmd
+	b.inputs[b.focus], cmd = b.inputs[b.focus].Update(msg)
+	return b, cmd
+}
+
+func (b *Browser) focusInput(i int) tea.Cmd {
+	b.inputs[b.focus].Blur()
+	b.focus = i
+	return b.inputs[i].Focus()
+}
+
+// submitForm saves the entry in the form, keeping the form open on errors
+func (b *Browser) submitForm() tea.Cmd {
+	entry := BrowserEntry{
+		Name:     strings.TrimSpace(b.inputs[0].Value()),
+		Username: b.inputs[1].Value(),
+		Password: b.inputs[2].Value(),
+		URLs:     b.inputs[3].Value(),
+		Notes:    b.inputs[4].Value(),
+		Tags:     b.inputs[5].Value(),
+	}
+	if err := b.store.Put(b.editing, entry); err != nil {
+		b.setStatus(err.Error(), false)
+		return nil
+	}
+	verb := "updated"
+	if b.editing == "" {
+		verb = "added"
+	}
+	b.closeForm()
+	b.reloadStatus()
+	b.selectName(entry.Name)
+	b.setStatus(fmt.Sprintf("Entry '%s' %s.", entry.Name, verb), true)
+	return nil
+}
+
+// closeForm leaves the form and drops the values typed in it
+func (b *Browser) closeForm() {
+	b.inputs = nil
+	b.editing = ""
+	b.mode = browseList
+}
+
+// copy puts value on the clipboard and schedules clearing it
+func (b *Browser) copy(value, what string) tea.Cmd {
+	if value == "" {
+		b.setStatus(fmt.Sprintf("The %s is empty.", what), false)
+		return nil
+	}
+	if err := b.store.Copy(value); err != nil {
+		b.setStatus(err.Error(), false)
+		return nil
+	}
+	b.copied = value
+	b.copySeq++
+	if b.opts.ClearAfter <= 0 {
+		b.setStatus(fmt.Sprintf("Copied the %s.", what), true)
+		return nil
+	}
+	b.setStatus(fmt.Sprintf("Copied the %s, clearing it in %s.", what, b.opts.ClearAfter), true)
+	seq := b.copySeq
+	return tea.Tick(b.opts.ClearAfter, func(time.Time) tea.Msg { return clipboardExpired{seq: seq} })
+}
+
+// clearClipboard clears a copied value that is still pending
+func (b *Browser) clearClipboard() {
+	if b.copied == "" || b.opts.ClearAfter <= 0 {
+		return
+	}
+	if err := b.store.ClearClipboard(b.copied); err != nil {
+		b.setStatus(err.Error(), false)
+	}
+	b.copied = ""
+}
+
+// quit clears the clipboard and exits
+func (b *Browser) quit() tea.Cmd {
+	b.clearClipboard()
+	return tea.Quit
+}
+
+// lock wipes the entries from the browser and the store, and exits
+func (b *Browser) lock() tea.Cmd {
+	b.clearClipboard()
+	b.entries = nil
+	b.closeForm()
+	b.store.Lock()
+	b.locked = true
+	return tea.Quit
+}
+
+// reload fetches the entries matching the filter, keeping the selection
+func (b *Browser) reload() error {
+	name := ""
+	if entry, ok := b.selected(); ok {
+		name = entry.Name
+	}
+	entries, err := b.store.Entries(b.filter.Value())
+	if err != nil {
+		return err
+	}
+	b.entries = entries
+	b.selectName(name)
+	return nil
+}
+
+// reloadStatus is reload reporting errors in the status line
+func (b *Browser) reloadStatus() {
+	if err := b.reload(); err != nil {
+		b.setStatus(err.Error(), false)
+	}
+}
+
+// selectName moves the cursor to the entry called name, if it is listed
+func (b *Browser) selectName(name string) {
+	for i, entry := range b.entries {
+		if strings.EqualFold(entry.Name, name) {
+			b.cursor = i
+			b.scroll()
+			return
+		}
+	}
+	b.move(0)
+}
+
+func (b *Browser) selected() (BrowserEntry, bool) {
+	if b.cursor < 0 || b.cursor >= len(b.entries) {
+		return BrowserEntry{}, false
+	}
+	return b.entries[b.cursor], true
+}
+
+// move moves the cursor by delta entries, within bounds
+func (b *Browser) move(delta int) {
+	b.cursor = max(0, min(b.cursor+delta, len(b.entries)-1))
+	b.scroll()
+}
+
+// scroll keeps the cursor within the visible part of the list
+func (b *Browser) scroll() {
+	height := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+height {
+		b.offset = b.cursor - height + 1
+	}
+	b.offset = max(0, b.offset)
+}
+
+func (b *Browser) setStatus(status string, ok bool) {
+	b.status, b.statusOK = status, ok
+}
+
+// listHeight is the number of entries that fit on screen
+func (b *Browser) listHeight() int {
+	return max(1, b.height-5)
+}
+
+// listWidth is the width of the entry list pane
+func (b *Browser) listWidth() int {
+	return max(16, min(32, b.width/3))
+}
+
+func (b *Browser) View() string {
+	if b.locked || b.width == 0 {
+		return ""
+	}
+
+	header := lipgloss.JoinHorizontal(lipgloss.Center,
+		TitleStyle.MarginBottom(0).Render(IconVault+"  vaulta"),
+		"   ",
+		b.filter.View(),
+	)
+
+	var right string
+	switch b.mode {
+	case browseForm:
+		right = b.viewForm()
+	default:
+		right = b.viewDetail()
+	}
+	paneHeight := b.listHeight() + 2
+	body := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(Subtle).
+			Width(b.listWidth()).
+			Height(paneHeight-2).
+			Render(b.viewList()),
+		lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(Primary).
+			Padding(0, 1).
+			Width(max(20, b.width-b.listWidth()-6)).
+			Height(paneHeight-2).
+			Render(right),
+	)
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, b.viewStatus(), b.viewHelp())
+}
+
+func (b *Browser) viewList() string {
+	if len(b.entries) == 0 {
+		return DimStyle.Render("  No entries found")
+	}
+	var lines []string
+	end := min(len(b.entries), b.offset+b.listHeight())
+	for i := b.offset; i < end; i++ {
+		name := truncate(b.entries[i].Name, b.listWidth()-4)
+		if i == b.cursor {
+			lines = append(lines, ListBulletSelected.String()+ListSelectedStyle.PaddingLeft(0).Render(name))
+		} else {
+			lines = append(lines, "  "+ValueStyle.Render(name))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *Browser) viewDetail() string {
+	entry, ok := b.selected()
+	if !ok {
+		return DimStyle.Render("Press a to add an entry.")
+	}
+
+	reveal := func(value string, secret bool) string {
+		if secret && !b.revealed && value != "" {
+			return browserMask
+		}
+		return value
+	}
+	rows := []BrowserRow{
+		{Label: "Username", Value: entry.Username},
+		{Label: "Password", Value: entry.Password, Secret: true},
+		{Label: "URLs", Value: entry.URLs},
+		{Label: "Notes", Value: entry.Notes},
+		{Label: "Tags", Value: entry.Tags},
+	}
+	rows = append(rows, entry.Extra...)
+
+	lines := []string{EntryTitleStyle.Render(fmt.Sprintf("%s  %s", IconKey, entry.Name))}
+	for _, row := range rows {
+		if row.Value == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s",
+			EntryLabelStyle.Render(row.Label+":"),
+			EntryValueStyle.Render(reveal(row.Value, row.Secret)),
+		))
+	}
+	if b.mode == browseConfirmDelete {
+		lines = append(lines, "", ErrorStyle.Render(fmt.Sprintf("%s Delete '%s'? (y/n)", IconWarning, entry.Name)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *Browser) viewForm() string {
+	title := "Edit " + b.editing
+	if b.editing == "" {
+		title = "New Entry"
+	}
+	lines := []string{EntryTitleStyle.Render(fmt.Sprintf("%s  %s", IconKey, title))}
+	for i, input := range b.inputs {
+		label := EntryLabelStyle.Render(formLabels[i] + ":")
+		if i == b.focus {
+			label = EntryLabelStyle.Bold(true).Foreground(Primary).Render(formLabels[i] + ":")
+		}
+		lines = append(lines, label+" "+input.View())
+	}
+	lines = append(lines, "", DimStyle.Render("URLs and tags are comma separated. Other fields are kept."))
+	return strings.Join(lines, "\n")
+}
+
+func (b *Browser) viewStatus() string {
+	var parts []string
+	if b.status != "" {
+		if b.statusOK {
+			parts = append(parts, SuccessStyle.Render(b.status))
+		} else {
+			parts = append(parts, ErrorStyle.Render(IconCross+" "+b.status))
+		}
+	}
+	if b.opts.IdleTimeout > 0 {
+		left := max(0, b.opts.IdleTimeout-time.Since(b.lastActive)).Round(time.Second)
+		parts = append(parts, DimStyle.Render(fmt.Sprintf("%s locks in %s", IconLock, left)))
+	}
+	return " " + strings.Join(parts, DimStyle.Render("  ·  "))
+}
+
+func (b *Browser) viewHelp() string {
+	var help string
+	switch b.mode {
+	case browseFilter:
+		help = "type to filter · enter done · esc clear"
+	case browseForm:
+		help = "tab/↑↓ move · ctrl+r reveal · ctrl+s or enter on Tags save · esc cancel"
+	case browseConfirmDelete:
+		help = "y delete · any other key cancel"
+	default:
+		help = "↑↓ move · / filter · r reveal · c copy password · u copy username · e edit · a add · d delete · q quit"
+	}
+	return HelpStyle.MarginTop(0).Render(" " + help)
+}
+
+// truncate shortens s to width cells, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && lipgloss.Width(string(r))+1 > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
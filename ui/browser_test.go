@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// testStore is a BrowserStore over a map of entries by name
+type testStore struct {
+	entries map[string]BrowserEntry
+	deleted []string
+	locked  bool
+}
+
+func newTestStore(entries ...BrowserEntry) *testStore {
+	s := &testStore{entries: make(map[string]BrowserEntry)}
+	for _, entry := range entries {
+		s.entries[entry.Name] = entry
+	}
+	return s
+}
+
+func (s *testStore) Entries(query string) ([]BrowserEntry, error) {
+	var out []BrowserEntry
+	for name, entry := range s.entries {
+		if strings.Contains(name, query) {
+			out = append(out, entry)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (s *testStore) Put(oldName string, entry BrowserEntry) error {
+	delete(s.entries, oldName)
+	s.entries[entry.Name] = entry
+	return nil
+}
+
+func (s *testStore) Delete(name string) error {
+	delete(s.entries, name)
+	s.deleted = append(s.deleted, name)
+	return nil
+}
+
+func (s *testStore) Copy(value string) error           { return nil }
+func (s *testStore) ClearClipboard(value string) error { return nil }
+func (s *testStore) Lock()                             { s.locked = true }
+
+// newTestBrowser returns a browser over store with its entries loaded
+func newTestBrowser(t *testing.T, store BrowserStore, opts BrowserOptions) *Browser {
+	t.Helper()
+	b := NewBrowser(store, opts)
+	if err := b.reload(); err != nil {
+		t.Fatal(err)
+	}
+	b.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	return b
+}
+
+// press sends each key to b, as typed
+func press(b *Browser, keys ...string) {
+	for _, key := range keys {
+		var msg tea.KeyMsg
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		}
+		b.Update(msg)
+	}
+}
+
+// names returns the names of the entries listed by b
+func names(b *Browser) []string {
+	var out []string
+	for _, entry := range b.entries {
+		out = append(out, entry.Name)
+	}
+	return out
+}
+
+func TestBrowserFilter(t *testing.T) {
+	store := newTestStore(BrowserEntry{Name: "bank"}, BrowserEntry{Name: "github"}, BrowserEntry{Name: "gitlab"})
+	b := newTestBrowser(t, store, BrowserOptions{})
+	press(b, "down", "down")
+
+	press(b, "/", "g", "i", "t")
+	if b.mode != browseFilter {
+		t.Fatalf("mode is %d after /, want the filter", b.mode)
+	}
+	if want := []string{"github", "gitlab"}; !slices.Equal(names(b), want) {
+		t.Errorf("filtered entries are %q, want %q", names(b), want)
+	}
+	if entry, _ := b.selected(); entry.Name != "github" {
+		t.Errorf("selected %q after filtering, want the first match", entry.Name)
+	}
+
+	// Keys go to the list again once the filter is done, and it stays
+	press(b, "enter", "j")
+	if entry, _ := b.selected(); entry.Name != "gitlab" || b.filter.Value() != "git" {
+		t.Errorf("selected %q with filter %q, want gitlab with git", entry.Name, b.filter.Value())
+	}
+
+	press(b, "esc")
+	if want := []string{"bank", "github", "gitlab"}; !slices.Equal(names(b), want) {
+		t.Errorf("entries after clearing the filter are %q, want %q", names(b), want)
+	}
+	if entry, _ := b.selected(); entry.Name != "gitlab" {
+		t.Errorf("selected %q after clearing the filter, want gitlab kept", entry.Name)
+	}
+
+	press(b, "/", "x", "esc")
+	if b.mode != browseList || b.filter.Value() != "" || len(b.entries) != 3 {
+		t.Errorf("esc in the filter left mode %d, filter %q and %d entries", b.mode, b.filter.Value(), len(b.entries))
+	}
+}
+
+func TestBrowserReveal(t *testing.T) {
+	store := newTestStore(BrowserEntry{
+		Name:     "github",
+		Password: "s3cret",
+		Extra:    []BrowserRow{{Label: "pin", Value: "0042", Secret: true}, {Label: "email", Value: "me@example.com"}},
+	})
+	b := newTestBrowser(t, store, BrowserOptions{})
+
+	view := b.View()
+	if strings.Contains(view, "s3cret") || strings.Contains(view, "0042") {
+		t.Error("secrets are shown before being revealed")
+	}
+	if strings.Count(view, browserMask) != 2 || !strings.Contains(view, "me@example.com") {
+		t.Errorf("secrets are not masked, or other fields are:\n%s", view)
+	}
+
+	press(b, "r")
+	view = b.View()
+	if !strings.Contains(view, "s3cret") || !strings.Contains(view, "0042") || strings.Contains(view, browserMask) {
+		t.Errorf("r did not reveal the secrets:\n%s", view)
+	}
+
+	press(b, "r")
+	if strings.Contains(b.View(), "s3cret") {
+		t.Error("r did not hide the secrets again")
+	}
+}
+
+func TestBrowserConfirmDelete(t *testing.T) {
+	store := newTestStore(BrowserEntry{Name: "bank"}, BrowserEntry{Name: "github"})
+	b := newTestBrowser(t, store, BrowserOptions{})
+	press(b, "down")
+
+	press(b, "d")
+	if b.mode != browseConfirmDelete || !strings.Contains(b.View(), "Delete 'github'? (y/n)") {
+		t.Fatalf("d did not ask to confirm:\n%s", b.View())
+	}
+	press(b, "n")
+	if len(store.deleted) > 0 || b.mode != browseList || b.status != "Entry unchanged." {
+		t.Errorf("n deleted %q, left mode %d and status %q", store.deleted, b.mode, b.status)
+	}
+
+	// Keys that mean something elsewhere cancel too
+	press(b, "d", "q")
+	if len(store.deleted) > 0 || b.mode != browseList {
+		t.Errorf("q deleted %q and left mode %d", store.deleted, b.mode)
+	}
+
+	press(b, "d", "y")
+	if !slices.Equal(store.deleted, []string{"github"}) {
+		t.Errorf("y deleted %q, want github", store.deleted)
+	}
+	if want := []string{"bank"}; !slices.Equal(names(b), want) {
+		t.Errorf("entries after deleting are %q, want %q", names(b), want)
+	}
+	if b.status != "Entry 'github' deleted." {
+		t.Errorf("status is %q", b.status)
+	}
+
+	press(b, "d", "y")
+	press(b, "d")
+	if b.mode != browseList {
+		t.Error("d asked to delete from an empty list")
+	}
+}
+
+func TestBrowserIdleLock(t *testing.T) {
+	store := newTestStore(BrowserEntry{Name: "github", Password: "s3cret"})
+	b := newTestBrowser(t, store, BrowserOptions{IdleTimeout: time.Minute})
+
+	// A key press restarts the idle timer
+	b.lastActive = time.Now().Add(-50 * time.Second)
+	press(b, "j")
+	if _, cmd := b.Update(browserTick(time.Now())); store.locked || cmd == nil {
+		t.Fatal("locked the vault before the idle timeout")
+	}
+
+	b.lastActive = time.Now().Add(-time.Minute)
+	_, cmd := b.Update(browserTick(time.Now()))
+	if !store.locked || !b.locked {
+		t.Fatal("the vault was not locked after the idle timeout")
+	}
+	if cmd == nil {
+		t.Fatal("the browser did not quit once locked")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("the browser did not quit once locked")
+	}
+	if len(b.entries) > 0 || b.View() != "" {
+		t.Error("the entries are still shown once locked")
+	}
+
+	// Without a timeout the browser never locks
+	store = newTestStore(BrowserEntry{Name: "github"})
+	b = newTestBrowser(t, store, BrowserOptions{})
+	b.lastActive = time.Now().Add(-24 * time.Hour)
+	b.Update(browserTick(time.Now()))
+	if store.locked {
+		t.Error("locked the vault with no idle timeout")
+	}
+}
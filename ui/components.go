@@ -75,6 +75,13 @@ func (m PasswordInput) View() string {
 	)
 }
 
+// WithValue returns the input pre-filled with value
+func (m PasswordInput) WithValue(value string) PasswordInput {
+	m.textInput.SetValue(value)
+	m.textInput.CursorEnd()
+	return m
+}
+
 func (m PasswordInput) Value() string {
 	return m.textInput.Value()
 }
@@ -149,6 +156,13 @@ func (m TextInput) View() string {
 	)
 }
 
+// WithValue returns the input pre-filled with value
+func (m TextInput) WithValue(value string) TextInput {
+	m.textInput.SetValue(value)
+	m.textInput.CursorEnd()
+	return m
+}
+
 func (m TextInput) Value() string {
 	return m.textInput.Value()
 }
@@ -159,7 +173,16 @@ func (m TextInput) Cancelled() bool {
 
 // PromptPassword runs an interactive password prompt
 func PromptPassword(prompt string) (string, error) {
-	p := tea.NewProgram(NewPasswordInput(prompt))
+	return runPasswordInput(NewPasswordInput(prompt))
+}
+
+// EditPassword runs an interactive password prompt pre-filled with value
+func EditPassword(prompt, value string) (string, error) {
+	return runPasswordInput(NewPasswordInput(prompt).WithValue(value))
+}
+
+func runPasswordInput(input PasswordInput) (string, error) {
+	p := tea.NewProgram(input)
 	m, err := p.Run()
 	if err != nil {
 		return "", err
@@ -175,7 +198,16 @@ func PromptPassword(prompt string) (string, error) {
 
 // PromptText runs an interactive text prompt
 func PromptText(prompt, icon string) (string, error) {
-	p := tea.NewProgram(NewTextInput(prompt, icon))
+	return runTextInput(NewTextInput(prompt, icon))
+}
+
+// EditText runs an interactive text prompt pre-filled with value
+func EditText(prompt, icon, value string) (string, error) {
+	return runTextInput(NewTextInput(prompt, icon).WithValue(value))
+}
+
+func runTextInput(input TextInput) (string, error) {
+	p := tea.NewProgram(input)
 	m, err := p.Run()
 	if err != nil {
 		return "", err
@@ -218,24 +250,66 @@ func RenderInfo(title, content string) string {
 	return BoxStyle.Render(fmt.Sprintf("%s\n\n%s", titleRendered, content))
 }
 
+// Row is an extra labelled value shown by RenderEntry
+type Row struct {
+	Label string
+	Value string
+}
+
 // RenderEntry renders a vault entry nicely
-func RenderEntry(name, username, password string) string {
+func RenderEntry(name, username, password string, extra ...Row) string {
 	title := EntryTitleStyle.Render(fmt.Sprintf("%s  %s", IconKey, name))
 
-	usernameRow := fmt.Sprintf("%s %s",
-		EntryLabelStyle.Render("Username:"),
-		EntryValueStyle.Render(username),
-	)
-
-	passwordRow := fmt.Sprintf("%s %s",
-		EntryLabelStyle.Render("Password:"),
-		EntryValueStyle.Render(password),
-	)
+	rows := []string{
+		fmt.Sprintf("%s %s",
+			EntryLabelStyle.Render("Username:"),
+			EntryValueStyle.Render(username),
+		),
+		fmt.Sprintf("%s %s",
+			EntryLabelStyle.Render("Password:"),
+			EntryValueStyle.Render(password),
+		),
+	}
+	for _, row := range extra {
+		rows = append(rows, fmt.Sprintf("%s %s",
+			EntryLabelStyle.Render(row.Label+":"),
+			EntryValueStyle.Render(row.Value),
+		))
+	}
 
-	content := fmt.Sprintf("%s\n\n%s\n%s", title, usernameRow, passwordRow)
+	content := fmt.Sprintf("%s\n\n%s", title, strings.Join(rows, "\n"))
 	return EntryBoxStyle.Render(content)
 }
 
+// Change is a field shown by RenderChanges
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// RenderChanges renders a diff-style comparison of an entry's old and new values
+func RenderChanges(name string, changes []Change) string {
+	title := EntryTitleStyle.Render(fmt.Sprintf("%s  %s", IconWarning, name))
+	removed := lipgloss.NewStyle().Foreground(Danger)
+	added := lipgloss.NewStyle().Foreground(Secondary)
+
+	var rows []string
+	for _, c := range changes {
+		if c.Old == c.New {
+			rows = append(rows, fmt.Sprintf("  %s %s", EntryLabelStyle.Render(c.Field+":"), DimStyle.Render(c.New)))
+			continue
+		}
+		rows = append(rows,
+			removed.Render(fmt.Sprintf("- %s %s", EntryLabelStyle.Render(c.Field+":"), c.Old)),
+			added.Render(fmt.Sprintf("+ %s %s", EntryLabelStyle.Render(c.Field+":"), c.New)),
+		)
+	}
+
+	content := fmt.Sprintf("%s\n\n%s", title, strings.Join(rows, "\n"))
+	return EntryBoxStyle.BorderForeground(Accent).Render(content)
+}
+
 // RenderList renders a list of entries
 func RenderList(title string, items []string) string {
 	titleRendered := TitleStyle.Render(fmt.Sprintf("%s  %s", IconList, title))
@@ -255,6 +329,78 @@ func RenderList(title string, items []string) string {
 	return BoxStyle.Render(content)
 }
 
+// RenderTable renders rows under a header in a titled box
+func RenderTable(title string, headers []string, rows [][]string) string {
+	titleRendered := TitleStyle.Render(fmt.Sprintf("%s  %s", IconList, title))
+	if len(rows) == 0 {
+		return BoxStyle.Render(fmt.Sprintf("%s\n\n%s", titleRendered, DimStyle.Render("  No entries found")))
+	}
+
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = lipgloss.Width(header)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], lipgloss.Width(cell))
+		}
+	}
+
+	var headerCells []string
+	for i, header := range headers {
+		headerCells = append(headerCells, TableHeaderStyle.Width(widths[i]+2).Render(header))
+	}
+	lines := []string{lipgloss.JoinHorizontal(lipgloss.Top, headerCells...)}
+	for _, row := range rows {
+		var cells []string
+		for i, cell := range row {
+			cells = append(cells, TableCellStyle.Width(widths[i]+2).Render(cell))
+		}
+		lines = append(lines, lipgloss.JoinHorizontal(lipgloss.Top, cells...))
+	}
+
+	return BoxStyle.Render(fmt.Sprintf("%s\n\n%s", titleRendered, strings.Join(lines, "\n")))
+}
+
+// qrQuietZone is the number of light modules drawn around a QR code, the
+// minimum the specification asks for
+const qrQuietZone = 4
+
+// RenderQRCode draws QR code modules with half block characters, two rows per
+// line. Printed characters are dark modules, which suits paper. With invert
+// they are light modules instead, for terminals with light text on a dark
+// background.
+func RenderQRCode(modules [][]bool, invert bool) string {
+	size := len(modules) + 2*qrQuietZone
+	ink := func(x, y int) bool {
+		x, y = x-qrQuietZone, y-qrQuietZone
+		dark := y >= 0 && y < len(modules) && x >= 0 && x < len(modules)
+		if dark {
+			dark = modules[y][x]
+		}
+		return dark != invert
+	}
+
+	var b strings.Builder
+	for y := 0; y < size; y += 2 {
+		for x := range size {
+			top, bottom := ink(x, y), y+1 < size && ink(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
 // RenderDivider renders a styled divider
 func RenderDivider() string {
 	return DimStyle.Render(strings.Repeat("─", 50))
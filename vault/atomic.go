@@ -0,0 +1,104 @@
+package vault
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// backupSuffix is appended to the vault path to name the copy of the
+// previous vault file
+const backupSuffix = ".bak"
+
+// File system operations used by writeFileAtomic, replaced in tests to
+// simulate failures
+var (
+	createTemp = os.CreateTemp
+	syncFile   = (*os.File).Sync
+	closeFile  = (*os.File).Close
+	backupFile = keepBackup
+	renameFile = os.Rename
+	syncDirFn  = syncDir
+)
+
+// writeFileAtomic replaces the file at path with the content written by
+// write, so that a crash, a full disk or an interrupt leaves either the old
+// or the new file in place, never a truncated one. The content goes to a
+// temporary file in the same directory, which is synced and renamed over
+// path before the directory itself is synced. With backup, the previous file
+// is kept at path + ".bak".
+func writeFileAtomic(path string, backup bool, write func(io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := createTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := tmp.Chmod(0600); err != nil {
+		return err
+	}
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		return err
+	}
+	if err := closeFile(tmp); err != nil {
+		return err
+	}
+	if backup {
+		if err := backupFile(path); err != nil {
+			return err
+		}
+	}
+	if err := renameFile(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDirFn(dir)
+}
+
+// keepBackup makes path + ".bak" a copy of the file at path, if there is one
+func keepBackup(path string) error {
+	backup := path + backupSuffix
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err := os.Link(path, backup)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	// Not every file system supports hard links, fall back to a copy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backup, data, 0600)
+}
+
+// syncDir flushes a directory entry change, such as a rename, to disk
+func syncDir(dir string) error {
+	// Directories cannot be opened for syncing on Windows, where renames are
+	// journaled by NTFS anyway
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failAt replaces the file system operation named step with one that fails,
+// and restores it when the test ends
+func failAt(t *testing.T, step string) {
+	t.Helper()
+	create, sync, closeF, backup, rename, dirSync := createTemp, syncFile, closeFile, backupFile, renameFile, syncDirFn
+	t.Cleanup(func() {
+		createTemp, syncFile, closeFile, backupFile, renameFile, syncDirFn = create, sync, closeF, backup, rename, dirSync
+	})
+
+	switch step {
+	case "create":
+		createTemp = func(string, string) (*os.File, error) { return nil, errInjected }
+	case "sync":
+		syncFile = func(*os.File) error { return errInjected }
+	case "close":
+		closeFile = func(f *os.File) error {
+			f.Close()
+			return errInjected
+		}
+	case "backup":
+		backupFile = func(string) error { return errInjected }
+	case "rename":
+		renameFile = func(string, string) error { return errInjected }
+	case "dir-sync":
+		syncDirFn = func(string) error { return errInjected }
+	case "write":
+	default:
+		t.Fatalf("unknown step %q", step)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// tempFiles returns the temporary files left in dir
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tmp []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			tmp = append(tmp, entry.Name())
+		}
+	}
+	return tmp
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	for _, content := range []string{"first", "second"} {
+		err := writeFileAtomic(path, true, func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readFile(t, path); got != "second" {
+		t.Errorf("vault file holds %q, want %q", got, "second")
+	}
+	if got := readFile(t, path+backupSuffix); got != "first" {
+		t.Errorf("backup holds %q, want %q", got, "first")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("vault file mode is %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	if tmp := tempFiles(t, filepath.Dir(path)); len(tmp) > 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+}
+
+func TestWriteFileAtomicFailures(t *testing.T) {
+	tests := []struct {
+		step string
+		// replaced is set for failures after the new file took the place of
+		// the old one, which is then found in the backup
+		replaced bool
+	}{
+		{step: "create"},
+		{step: "write"},
+		{step: "sync"},
+		{step: "close"},
+		{step: "backup"},
+		{step: "rename"},
+		{step: "dir-sync", replaced: true},
+	}
+	for _, test := range tests {
+		t.Run(test.step, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "vault.json")
+			if err := os.WriteFile(path, []byte("original"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			failAt(t, test.step)
+			err := writeFileAtomic(path, true, func(w io.Writer) error {
+				if _, err := io.WriteString(w, "upd"); err != nil {
+					return err
+				}
+				if test.step == "write" {
+					return errInjected
+				}
+				_, err := io.WriteString(w, "ated")
+				return err
+			})
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("writeFileAtomic returned %v, want the injected failure", err)
+			}
+
+			if test.replaced {
+				if got := readFile(t, path); got != "updated" {
+					t.Errorf("vault file holds %q, want %q", got, "updated")
+				}
+				if got := readFile(t, path+backupSuffix); got != "original" {
+					t.Errorf("backup holds %q, want %q", got, "original")
+				}
+			} else if got := readFile(t, path); got != "original" {
+				t.Errorf("vault file holds %q, want %q", got, "original")
+			}
+			if tmp := tempFiles(t, dir); len(tmp) > 0 {
+				t.Errorf("temporary files left behind: %v", tmp)
+			}
+		})
+	}
+}
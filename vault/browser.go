@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// DefaultIdleTimeout is how long the browser stays unlocked without a key
+// press.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// ErrNotTerminal is returned when the browser is started without a terminal.
+var ErrNotTerminal = errors.New("the browser needs an interactive terminal")
+
+// browserStore gives the browser access to an unlocked session. The session
+// does not hold the lock on the vault between operations, so other vaulta
+// commands can run while the browser is open. Each operation takes the lock
+// and first picks up the changes they made.
+type browserStore struct {
+	v        *Vault
+	session  *Session
+	readable bool
+}
+
+func (b *browserStore) Entries(query string) ([]ui.BrowserEntry, error) {
+	// Entries are refreshed every second, so rather than wait for another
+	// process writing the vault, show them as last read
+	err := b.session.relock(0)
+	if err == nil {
+		err = b.session.releaseLock()
+	}
+	var locked *LockedError
+	if err != nil && !errors.As(err, &locked) {
+		return nil, err
+	}
+
+	names, err := b.session.Search(query)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ui.BrowserEntry, 0, len(names))
+	for _, name := range names {
+		entry, err := b.session.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, browserEntry(name, entry))
+	}
+	return entries, nil
+}
+
+// browserEntry converts entry for the browser. Custom fields, the current
+// TOTP code and timestamps are shown as extra rows.
+func browserEntry(name string, entry Entry) ui.BrowserEntry {
+	e := ui.BrowserEntry{
+		Name:     name,
+		Username: entry.Username,
+		Password: entry.Password,
+		URLs:     strings.Join(entry.URLs, ", "),
+		Notes:    entry.Notes,
+		Tags:     strings.Join(entry.Tags, ", "),
+	}
+	for _, field := range entry.Fields {
+		e.Extra = append(e.Extra, ui.BrowserRow{Label: field.Name, Value: field.Value, Secret: field.Type == FieldHidden})
+	}
+	if entry.TOTP != "" {
+		e.Extra = append(e.Extra, ui.BrowserRow{Label: "TOTP", Value: currentCode(entry.TOTP)})
+	}
+	if !entry.Modified.IsZero() {
+		e.Extra = append(e.Extra, ui.BrowserRow{Label: "Modified", Value: entry.Modified.Local().Format(time.DateTime)})
+	}
+	return e
+}
+
+func (b *browserStore) Put(oldName string, e ui.BrowserEntry) error {
+	name := normalizeName(e.Name)
+	if name == "" {
+		return ErrEmptyName
+	}
+	if err := b.session.relock(lockTimeout); err != nil {
+		return err
+	}
+	defer b.session.releaseLock()
+
+	var entry Entry
+	if oldName != "" {
+		old, err := b.session.Get(oldName)
+		if err != nil {
+			return err
+		}
+		entry = old
+	}
+	if normalizeName(oldName) != name {
+		if _, err := b.session.Get(name); err == nil {
+			return fmt.Errorf("%w: '%s'", ErrEntryExists, name)
+		}
+	}
+
+	entry.Username = e.Username
+	entry.Password = e.Password
+	entry.URLs = splitTags(e.URLs)
+	entry.Notes = e.Notes
+	entry.Tags = splitTags(e.Tags)
+
+	if oldName != "" && normalizeName(oldName) != name {
+		b.session.rename(oldName, name)
+	}
+	if err := b.session.Put(name, entry); err != nil {
+		return err
+	}
+	return b.session.Save()
+}
+
+func (b *browserStore) Delete(name string) error {
+	if err := b.session.relock(lockTimeout); err != nil {
+		return err
+	}
+	defer b.session.releaseLock()
+	if err := b.session.Delete(name); err != nil {
+		return err
+	}
+	return b.session.Save()
+}
+
+func (b *browserStore) Copy(value string) error {
+	readable, err := b.v.copyToClipboard(value)
+	if err != nil {
+		return err
+	}
+	b.readable = readable
+	return nil
+}
+
+func (b *browserStore) ClearClipboard(value string) error {
+	_, err := b.v.clearClipboard(value, b.readable)
+	return err
+}
+
+func (b *browserStore) Lock() {
+	b.session.Close()
+}
+
+// rename moves the entry stored under oldName, with its history and
+// timestamps, to newName
+func (s *Session) rename(oldName, newName string) {
+	oldKey, newKey := normalizeName(oldName), normalizeName(newName)
+	if entry, ok := s.data.Entries[oldKey]; ok {
+		delete(s.data.Entries, oldKey)
+		s.data.Entries[newKey] = entry
+	}
+}
+
+// Browse unlocks the vault and opens the full-screen browser. The vault is
+// locked again after idle without a key press, unless idle is 0. Values
+// copied from the browser are cleared from the clipboard after clearAfter.
+func (v *Vault) Browse(idle, clearAfter time.Duration) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return ErrNotTerminal
+	}
+
+	v.logo()
+	v.title("🔍 Browse Vault")
+
+	session, err := v.unlock()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if err := session.releaseLock(); err != nil {
+		return err
+	}
+
+	store := &browserStore{v: v, session: session}
+	err = ui.RunBrowser(store, ui.BrowserOptions{IdleTimeout: idle, ClearAfter: clearAfter})
+	if errors.Is(err, ui.ErrBrowserLocked) {
+		v.println(ui.RenderInfo("Locked", fmt.Sprintf("The vault was locked after %s of inactivity.", idle)))
+		v.println()
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+func TestBrowserStoreLocking(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	session, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if session.lock == nil {
+		t.Skip("file locking is not supported here")
+	}
+	if err := session.releaseLock(); err != nil {
+		t.Fatal(err)
+	}
+	store := &browserStore{session: session}
+
+	// Another command changes the vault while the browser is open
+	other, err := Open(path, []byte("battery staple"))
+	if err != nil {
+		t.Fatalf("Open while the browser is open: %v", err)
+	}
+	if err := other.Put("gitlab", Entry{Password: "gl"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading waits for nobody and shows the entries as last read
+	entries, err := store.Entries("")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Entries while another command holds the lock returned %+v, %v", entries, err)
+	}
+	other.Close()
+
+	entries, err = store.Entries("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Name != "gitlab" {
+		t.Errorf("Entries = %+v, want github and gitlab", entries)
+	}
+
+	// Writes keep the changes of the other command
+	if err := store.Put("github", ui.BrowserEntry{Name: "github", Username: "me", Password: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("gitlab"); err != nil {
+		t.Fatal(err)
+	}
+	if session.lock != nil {
+		t.Error("the browser still holds the lock after saving")
+	}
+	if got := openEntry(t, path, "correct horse", "github"); got.Password != "new" {
+		t.Errorf("password is %q, want new", got.Password)
+	}
+	other, err = Open(path, []byte("battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get("gitlab"); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Get of the deleted entry returned %v, want %v", err, ErrEntryNotFound)
+	}
+	other.Close()
+
+	// A write waits for the lock like any other command
+	lock, err := lockVault(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.release()
+	var locked *LockedError
+	if err := session.relock(100 * time.Millisecond); !errors.As(err, &locked) {
+		t.Errorf("relock of a held vault returned %v, want a LockedError", err)
+	}
+}
+
+func TestSessionReloadRemovedSlot(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	session, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.releaseLock(); err != nil {
+		t.Fatal(err)
+	}
+	id := session.unlockedSlot().ID
+
+	other, err := Open(path, []byte("battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.RemoveKeySlot(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	if err := session.relock(time.Second); !errors.Is(err, ErrVaultChanged) {
+		t.Errorf("relock after the session's key slot was removed returned %v, want %v", err, ErrVaultChanged)
+	}
+	if session.lock != nil {
+		t.Error("a failed relock kept the lock")
+	}
+}
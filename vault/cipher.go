@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"slices"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Ciphers the payload and the wrapped keys can be encrypted with.
+const (
+	CipherAES256GCM         = "aes-256-gcm"
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// Ciphers lists the supported cipher algorithms.
+var Ciphers = []string{CipherAES256GCM, CipherXChaCha20Poly1305}
+
+// checkCipher refuses cipher algorithms vaulta does not know
+func checkCipher(algorithm string) error {
+	if !slices.Contains(Ciphers, algorithm) {
+		return fmt.Errorf("unsupported cipher algorithm %q", algorithm)
+	}
+	return nil
+}
+
+// newAEAD returns the AEAD of algorithm keyed with key. AES-256-GCM uses
+// 12-byte nonces and XChaCha20-Poly1305 24-byte ones, both random.
+func newAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, checkCipher(algorithm)
+}
+
+// encrypt encrypts plaintext with algorithm, authenticating additionalData
+// along with it, and returns nonce and ciphertext
+func encrypt(algorithm string, key, plaintext, additionalData []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err = randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext = aead.Seal(nil, nonce, plaintext, additionalData)
+	return nonce, ciphertext, nil
+}
+
+// decrypt decrypts ciphertext with algorithm, checking that it was encrypted
+// with the same additionalData
+func decrypt(algorithm string, key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrInvalidPassword
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrInvalidPassword
+	}
+
+	return plaintext, nil
+}
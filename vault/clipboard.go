@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// DefaultClipboardTimeout is how long a copied secret stays on the clipboard
+// by default.
+const DefaultClipboardTimeout = 45 * time.Second
+
+// ErrNoClipboard is returned when there is neither a clipboard utility nor a
+// terminal to copy through.
+var ErrNoClipboard = errors.New("no clipboard available, install xclip, xsel or wl-clipboard")
+
+// CopyEntry puts a field of an entry on the clipboard, its password by
+// default. With clearAfter, it then waits and clears the clipboard, unless
+// something else was copied meanwhile. Interrupting the wait clears it right
+// away.
+func (v *Vault) CopyEntry(name, field string, clearAfter time.Duration) error {
+	v.logo()
+	v.title("📋 Copy Entry")
+
+	if field == "" {
+		field = "password"
+	}
+	entry, err := v.accessEntry(name)
+	if err != nil {
+		return err
+	}
+	value, err := entry.fieldValue(field)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("the %s of '%s' is empty", field, name)
+	}
+
+	return v.copyAndClear(value, fmt.Sprintf("%s of '%s'", field, name), clearAfter)
+}
+
+// copyAndClear copies value, described by what, to the clipboard and clears
+// it after clearAfter, if set, as long as it was not replaced meanwhile
+func (v *Vault) copyAndClear(value, what string, clearAfter time.Duration) error {
+	readable, err := v.copyToClipboard(value)
+	if err != nil {
+		return err
+	}
+	v.println(ui.RenderSuccess(fmt.Sprintf("Copied the %s to the clipboard.", what)))
+	if clearAfter <= 0 {
+		return nil
+	}
+
+	v.println(ui.DimStyle.Render(fmt.Sprintf("  Clearing it in %s, press Ctrl+C to clear it now.", clearAfter)))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case <-time.After(clearAfter):
+	case <-ctx.Done():
+	}
+
+	cleared, err := v.clearClipboard(value, readable)
+	if err != nil {
+		return err
+	}
+	if cleared {
+		v.println(ui.RenderSuccess("Clipboard cleared."))
+	} else {
+		v.println(ui.RenderInfo("Info", "Something else was copied meanwhile, the clipboard was left as is."))
+	}
+	return nil
+}
+
+// copyToClipboard puts text on the system clipboard. Where no clipboard
+// utility works, such as over SSH, it asks the terminal to do it with an OSC
+// 52 escape sequence instead. It reports whether the clipboard can be read
+// back, which the OSC 52 fallback cannot.
+func (v *Vault) copyToClipboard(text string) (readable bool, err error) {
+	if !clipboard.Unsupported {
+		if err := clipboard.WriteAll(text); err == nil {
+			return true, nil
+		}
+	}
+	if !isTerminal(os.Stderr) {
+		return false, ErrNoClipboard
+	}
+	_, err = terminalClipboard(osc52.New(text)).WriteTo(os.Stderr)
+	return false, err
+}
+
+// clearClipboard empties the clipboard if it still holds text and reports
+// whether it did. A clipboard that cannot be read back is always cleared.
+func (v *Vault) clearClipboard(text string, readable bool) (bool, error) {
+	if !readable {
+		_, err := terminalClipboard(osc52.Clear()).WriteTo(os.Stderr)
+		return err == nil, err
+	}
+
+	current, err := clipboard.ReadAll()
+	if err != nil {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(current), []byte(text)) != 1 {
+		return false, nil
+	}
+	return true, clipboard.WriteAll("")
+}
+
+// terminalClipboard wraps an OSC 52 sequence for the terminal multiplexer
+// vaulta runs in, if any
+func terminalClipboard(seq osc52.Sequence) osc52.Sequence {
+	switch {
+	case os.Getenv("TMUX") != "":
+		return seq.Tmux()
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		return seq.Screen()
+	}
+	return seq
+}
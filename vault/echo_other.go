@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package vault
+
+import (
+	"errors"
+	"os"
+)
+
+// setEcho is not supported on this platform
+func setEcho(f *os.File, on bool) error {
+	return errors.New("disabling echo is not supported on this platform")
+}
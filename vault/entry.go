@@ -0,0 +1,277 @@
+package vault
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// maskedSecret is shown in place of a secret that must not be displayed
+const maskedSecret = "••••••••"
+
+// FieldType is the kind of value held by a custom field.
+type FieldType string
+
+const (
+	// FieldText is a plain text value.
+	FieldText FieldType = "text"
+	// FieldHidden is a secret value, masked like the entry password.
+	FieldHidden FieldType = "hidden"
+	// FieldURL is a URL.
+	FieldURL FieldType = "url"
+	// FieldEmail is an email address.
+	FieldEmail FieldType = "email"
+)
+
+// Field is a named custom value attached to an entry.
+type Field struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Value string    `json:"value"`
+}
+
+// validate checks that the value matches the field type
+func (f Field) validate() error {
+	switch f.Type {
+	case FieldText, FieldHidden:
+	case FieldURL:
+		if u, err := url.Parse(f.Value); err != nil || u.Scheme == "" {
+			return fmt.Errorf("field %q is not a valid URL: %q", f.Name, f.Value)
+		}
+	case FieldEmail:
+		if _, err := mail.ParseAddress(f.Value); err != nil {
+			return fmt.Errorf("field %q is not a valid email address: %q", f.Name, f.Value)
+		}
+	default:
+		return fmt.Errorf("unknown type %q for field %q, expected one of text, hidden, url, email", f.Type, f.Name)
+	}
+	return nil
+}
+
+// ParseField parses a custom field given as name=value or name:type=value.
+// Fields without a type are text fields.
+func ParseField(s string) (Field, error) {
+	spec, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return Field{}, fmt.Errorf("invalid field %q, expected name[:type]=value", s)
+	}
+	name, typ, _ := strings.Cut(spec, ":")
+	field := Field{Name: strings.TrimSpace(name), Type: FieldType(strings.ToLower(strings.TrimSpace(typ))), Value: value}
+	if field.Name == "" {
+		return Field{}, fmt.Errorf("invalid field %q, the name is empty", s)
+	}
+	if field.Type == "" {
+		field.Type = FieldText
+	}
+	return field, field.validate()
+}
+
+type Entry struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	URLs     []string `json:"urls,omitempty"`
+	Notes    string   `json:"notes,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Fields   []Field  `json:"fields,omitempty"`
+	// TOTP is a TOTP secret in base32 or as an otpauth URI, see ParseTOTP
+	TOTP     string    `json:"totp,omitempty"`
+	Created  time.Time `json:"created,omitzero"`
+	Modified time.Time `json:"modified,omitzero"`
+	Accessed time.Time `json:"accessed,omitzero"`
+	History  []Version `json:"history,omitempty"`
+}
+
+// Field returns the custom field called name.
+func (e Entry) Field(name string) (Field, bool) {
+	for _, field := range e.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// SetField adds or replaces a custom field. An empty value removes it. An
+// invalid field leaves the entry unchanged.
+func (e *Entry) SetField(field Field) error {
+	if field.Value != "" {
+		if err := field.validate(); err != nil {
+			return err
+		}
+	}
+	for i, existing := range e.Fields {
+		if strings.EqualFold(existing.Name, field.Name) {
+			if field.Value == "" {
+				e.Fields = append(e.Fields[:i:i], e.Fields[i+1:]...)
+				return nil
+			}
+			// The fields may be shared with the stored entry, which becomes
+			// the previous version
+			e.Fields = slices.Clone(e.Fields)
+			e.Fields[i] = field
+			return nil
+		}
+	}
+	if field.Value == "" {
+		return nil
+	}
+	e.Fields = append(e.Fields[:len(e.Fields):len(e.Fields)], field)
+	return nil
+}
+
+// setField sets the entry field named field to value. Custom fields are set
+// with "field.<name>" or "field.<name>:<type>".
+func (e *Entry) setField(field, value string) error {
+	field = strings.TrimSpace(field)
+	if custom, ok := strings.CutPrefix(field, "field."); ok {
+		name, typ, _ := strings.Cut(custom, ":")
+		f := Field{Name: name, Type: FieldType(strings.ToLower(typ)), Value: value}
+		if f.Type == "" {
+			f.Type = FieldText
+			if existing, ok := e.Field(name); ok {
+				f.Type = existing.Type
+			}
+		}
+		return e.SetField(f)
+	}
+
+	switch strings.ToLower(field) {
+	case "username":
+		e.Username = value
+	case "password", "secret":
+		e.Password = value
+	case "url", "urls":
+		e.URLs = splitTags(value)
+	case "notes":
+		e.Notes = value
+	case "tags":
+		e.Tags = splitTags(value)
+	case "totp":
+		if value != "" {
+			if _, err := ParseTOTP(value); err != nil {
+				return err
+			}
+		}
+		e.TOTP = strings.TrimSpace(value)
+	default:
+		return fmt.Errorf("unknown field %q, expected one of username, password, urls, notes, tags, totp or field.<name>", field)
+	}
+	return nil
+}
+
+// fieldValue returns the value of the entry field named field, with the same
+// names as setField. Custom fields may also be given by their bare name.
+func (e Entry) fieldValue(field string) (string, error) {
+	field = strings.TrimSpace(field)
+	if custom, ok := strings.CutPrefix(field, "field."); ok {
+		name, _, _ := strings.Cut(custom, ":")
+		if f, ok := e.Field(name); ok {
+			return f.Value, nil
+		}
+		return "", fmt.Errorf("the entry has no field %q", name)
+	}
+
+	switch strings.ToLower(field) {
+	case "username":
+		return e.Username, nil
+	case "password", "secret":
+		return e.Password, nil
+	case "url", "urls":
+		return strings.Join(e.URLs, "\n"), nil
+	case "notes":
+		return e.Notes, nil
+	case "tags":
+		return strings.Join(e.Tags, ", "), nil
+	case "totp":
+		return e.TOTP, nil
+	}
+	if f, ok := e.Field(field); ok {
+		return f.Value, nil
+	}
+	return "", fmt.Errorf("unknown field %q, expected one of username, password, urls, notes, tags, totp or a custom field", field)
+}
+
+// stamp sets the timestamps of entry when it replaces old, or when it is new
+// if old is nil
+func (e *Entry) stamp(old *Entry, at time.Time) {
+	if old == nil {
+		e.Created, e.Modified, e.Accessed = at, at, time.Time{}
+		return
+	}
+	e.Created, e.Modified, e.Accessed = old.Created, old.Modified, old.Accessed
+	if !e.sameContent(*old) {
+		e.Modified = at
+	}
+}
+
+// entryChanges lists the fields of old and new for a confirmation diff, with
+// the secrets masked
+func entryChanges(old, new Entry) []ui.Change {
+	secret := maskedSecret
+	if old.Password != new.Password {
+		secret += " (changed)"
+	}
+	changes := []ui.Change{
+		{Field: "Username", Old: old.Username, New: new.Username},
+		{Field: "Secret", Old: maskedSecret, New: secret},
+		{Field: "URLs", Old: strings.Join(old.URLs, ", "), New: strings.Join(new.URLs, ", ")},
+		{Field: "Notes", Old: old.Notes, New: new.Notes},
+		{Field: "Tags", Old: strings.Join(old.Tags, ", "), New: strings.Join(new.Tags, ", ")},
+	}
+	if old.TOTP != "" || new.TOTP != "" {
+		change := ui.Change{Field: "TOTP", Old: maskedValue(old.TOTP), New: maskedValue(new.TOTP)}
+		if old.TOTP != new.TOTP && change.Old == change.New {
+			change.New += " (changed)"
+		}
+		changes = append(changes, change)
+	}
+
+	names := map[string]bool{}
+	for _, f := range append(old.Fields, new.Fields...) {
+		key := strings.ToLower(f.Name)
+		if names[key] {
+			continue
+		}
+		names[key] = true
+		oldField, _ := old.Field(f.Name)
+		newField, _ := new.Field(f.Name)
+		change := ui.Change{Field: f.Name, Old: displayValue(oldField), New: displayValue(newField)}
+		if change.Old == change.New && oldField.Value != newField.Value {
+			change.New += " (changed)"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// displayValue returns the value of a field, masked if it is hidden
+func displayValue(f Field) string {
+	if f.Type == FieldHidden {
+		return maskedValue(f.Value)
+	}
+	return f.Value
+}
+
+// maskedValue masks a secret, leaving an unset one empty
+func maskedValue(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return maskedSecret
+}
+
+// splitTags splits a comma separated list of tags
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetField(t *testing.T) {
+	fields := []Field{
+		{Name: "pin", Type: FieldHidden, Value: "0042"},
+		{Name: "email", Type: FieldEmail, Value: "me@example.com"},
+	}
+	tests := []struct {
+		name  string
+		field Field
+		want  []Field
+		err   bool
+	}{
+		{"add", Field{Name: "site", Type: FieldURL, Value: "https://x.org"}, append(slices.Clone(fields), Field{Name: "site", Type: FieldURL, Value: "https://x.org"}), false},
+		{"replace", Field{Name: "PIN", Type: FieldHidden, Value: "1234"}, []Field{{Name: "PIN", Type: FieldHidden, Value: "1234"}, fields[1]}, false},
+		{"remove", Field{Name: "pin", Type: FieldHidden}, fields[1:], false},
+		{"remove missing", Field{Name: "site", Type: FieldURL}, fields, false},
+		// A rejected value leaves the entry as it was
+		{"invalid replacement", Field{Name: "email", Type: FieldEmail, Value: "not an address"}, fields, true},
+		{"invalid addition", Field{Name: "site", Type: FieldURL, Value: "x.org"}, fields, true},
+		{"unknown type", Field{Name: "pin", Type: "number", Value: "42"}, fields, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := Entry{Fields: slices.Clone(fields)}
+			stored := entry
+			err := entry.SetField(test.field)
+			if (err != nil) != test.err {
+				t.Fatalf("SetField returned %v", err)
+			}
+			if !slices.Equal(entry.Fields, test.want) {
+				t.Errorf("fields are %+v, want %+v", entry.Fields, test.want)
+			}
+			// A copy of the entry, such as the one stored in the vault, is
+			// left alone
+			if !slices.Equal(stored.Fields, fields) {
+				t.Errorf("SetField changed a copy of the entry to %+v", stored.Fields)
+			}
+		})
+	}
+}
+
+func TestSetFieldKeepsEntryOnError(t *testing.T) {
+	entry := Entry{Username: "me", Fields: []Field{{Name: "email", Type: FieldEmail, Value: "me@example.com"}}}
+	if err := entry.setField("field.email", "not an address"); err == nil {
+		t.Fatal("setField accepted an invalid email address")
+	}
+	if err := entry.setField("totp", "not base32!"); err == nil {
+		t.Fatal("setField accepted an invalid TOTP secret")
+	}
+	if err := entry.setField("colour", "blue"); err == nil {
+		t.Fatal("setField accepted an unknown field")
+	}
+	if f, _ := entry.Field("email"); f.Value != "me@example.com" || entry.TOTP != "" || entry.Username != "me" {
+		t.Errorf("rejected assignments changed the entry to %+v", entry)
+	}
+
+	// The type of an existing field is kept when none is given
+	if err := entry.setField("field.email", "you@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := entry.Field("email"); f.Type != FieldEmail || f.Value != "you@example.com" {
+		t.Errorf("field is %+v, want the new email address", f)
+	}
+}
+
+func TestEditFieldKeepsHistory(t *testing.T) {
+	session := newTestSession(t, map[string]Entry{
+		"github": {Fields: []Field{{Name: "pin", Type: FieldHidden, Value: "0042"}}},
+	})
+	entry, err := session.Get("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.setField("field.pin", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Put("github", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := session.History("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Fields[0].Value != "0042" {
+		t.Errorf("history is %+v, want the previous pin", history)
+	}
+}
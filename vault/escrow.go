@@ -0,0 +1,329 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+const (
+	// escrowKeySize is the number of random bytes in an escrow key
+	escrowKeySize = 16
+	// escrowHeaderSize is the number of bytes before the value of a share:
+	// the split it belongs to, the threshold and its x coordinate
+	escrowHeaderSize = 4
+	// escrowChecksumSize is the number of SHA-256 bytes appended to the share
+	// words to catch typos
+	escrowChecksumSize = 2
+)
+
+// ErrNoEscrowKey is returned when unlocking with escrow shares a vault that
+// has no escrow key.
+var ErrNoEscrowKey = errors.New("this vault has no escrow key")
+
+// EscrowShare is one Shamir share of an escrow key.
+type EscrowShare struct {
+	// Set identifies the split the share comes from, so shares of different
+	// splits are not mixed up.
+	Set       uint16
+	Threshold int
+	X         byte
+	Y         []byte
+}
+
+// validateSplit checks that n shares with the given threshold can be made
+func validateSplit(n, threshold int) error {
+	if threshold < 2 || threshold > n || n > 255 {
+		return fmt.Errorf("need 2 <= threshold <= shares <= 255, got threshold %d and %d shares", threshold, n)
+	}
+	return nil
+}
+
+// SplitEscrowKey splits escrow into n shares, any threshold of which recover
+// it. Fewer shares reveal nothing about it.
+func SplitEscrowKey(escrow []byte, n, threshold int) ([]EscrowShare, error) {
+	if err := validateSplit(n, threshold); err != nil {
+		return nil, err
+	}
+	set, err := randomBytes(2)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := splitSecret(escrow, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]EscrowShare, len(shares))
+	for i, s := range shares {
+		out[i] = EscrowShare{Set: binary.BigEndian.Uint16(set), Threshold: threshold, X: s.x, Y: s.y}
+	}
+	return out, nil
+}
+
+// Words returns the share written down as words: one word per byte of the
+// set, threshold, x coordinate and value, followed by checksum words.
+func (s EscrowShare) Words() []string {
+	data := binary.BigEndian.AppendUint16(nil, s.Set)
+	data = append(data, byte(s.Threshold), s.X)
+	data = append(data, s.Y...)
+	sum := sha256.Sum256(data)
+	data = append(data, sum[:escrowChecksumSize]...)
+	defer zero(data)
+	return encodeWords(data)
+}
+
+// ParseEscrowShare parses the words of an escrow share, separated by spaces
+// or dashes. Each word may be shortened to its first four letters, and line
+// numbers are ignored.
+func ParseEscrowShare(text string) (EscrowShare, error) {
+	words := splitWords(text)
+	if n := escrowHeaderSize + escrowKeySize + escrowChecksumSize; len(words) != n {
+		return EscrowShare{}, fmt.Errorf("an escrow share has %d words, got %d", n, len(words))
+	}
+
+	data, err := decodeWords(words)
+	if err != nil {
+		return EscrowShare{}, err
+	}
+	defer zero(data)
+	body := data[:len(data)-escrowChecksumSize]
+	sum := sha256.Sum256(body)
+	if !bytes.Equal(data[len(body):], sum[:escrowChecksumSize]) {
+		return EscrowShare{}, errors.New("escrow share checksum mismatch, check the words for typos")
+	}
+
+	share := EscrowShare{
+		Set:       binary.BigEndian.Uint16(body),
+		Threshold: int(body[2]),
+		X:         body[3],
+		Y:         bytes.Clone(body[escrowHeaderSize:]),
+	}
+	if share.Threshold < 2 || share.X == 0 {
+		return EscrowShare{}, errors.New("invalid escrow share")
+	}
+	return share, nil
+}
+
+// CombineEscrowShares recovers the escrow key from at least threshold shares
+// of the same split.
+func CombineEscrowShares(shares []EscrowShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no escrow shares")
+	}
+	first := shares[0]
+	points := make([]share, len(shares))
+	for i, s := range shares {
+		if s.Set != first.Set || s.Threshold != first.Threshold {
+			return nil, errors.New("the escrow shares come from different splits")
+		}
+		points[i] = share{x: s.X, y: s.Y}
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d escrow shares are needed, got %d", first.Threshold, len(shares))
+	}
+	return combineShares(points)
+}
+
+// HasEscrowKey reports whether the vault has an escrow key slot.
+func (s *Session) HasEscrowKey() bool {
+	return s.hasKeySlot(SlotEscrow)
+}
+
+// SetEscrowKey replaces any escrow key slot with one unlocked by escrow and
+// returns its ID. Changes are written by the next Save.
+func (s *Session) SetEscrowKey(escrow []byte, params KDFParams) (int, error) {
+	if s.key == nil {
+		return 0, ErrClosed
+	}
+	if s.unlockedSlot().Type == SlotEscrow {
+		return 0, errors.New("cannot replace the escrow key the vault was unlocked with, unlock it with your password first")
+	}
+	return s.replaceKeySlots(Key{Escrow: escrow}, params)
+}
+
+// SplitEscrow adds an escrow key slot, replacing any previous one, and
+// returns the n shares of its key to hand out, any threshold of which unlock
+// the vault. The shares hold a new random escrow key rather than the data key
+// itself: like a recovery key, it wraps the data key in a slot of its own, so
+// `keyslot remove` revokes the shares without re-encrypting the vault. The
+// slot uses the Argon2id parameters of the others, which adds no strength to
+// a random key but keeps every slot in the same format.
+func (v *Vault) SplitEscrow(n, threshold int) (string, error) {
+	if err := validateSplit(n, threshold); err != nil {
+		return "", err
+	}
+
+	v.logo()
+	v.title("🤝 Escrow Split")
+
+	session, err := v.unlock()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	if session.HasEscrowKey() {
+		replace, err := v.prompter.Confirm("This vault already has escrow shares, which will stop working. Replace them?")
+		if err != nil {
+			return "", err
+		}
+		if !replace {
+			v.println(ui.RenderInfo("Info", "Escrow shares unchanged."))
+			return "", nil
+		}
+	}
+
+	escrow, err := randomBytes(escrowKeySize)
+	if err != nil {
+		return "", err
+	}
+	defer zero(escrow)
+	shares, err := SplitEscrowKey(escrow, n, threshold)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := session.SetEscrowKey(escrow, session.KDFParams())
+	if err != nil {
+		return "", err
+	}
+	if err := session.Save(); err != nil {
+		return "", err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Escrow key added in key slot %d, any %d of the %d shares unlock the vault.", id, threshold, n)))
+	v.println(ui.RenderWarning("Hand each share to a different person. The shares are shown only once."))
+
+	out := escrowOutput{Slot: id, Threshold: threshold}
+	for _, share := range shares {
+		out.Shares = append(out.Shares, share.Words())
+	}
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(out)
+	case FormatYAML:
+		return marshalYAML(out)
+	case FormatRaw:
+		var lines []string
+		for _, words := range out.Shares {
+			lines = append(lines, strings.Join(words, " "))
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		var boxes []string
+		for i, words := range out.Shares {
+			boxes = append(boxes, ui.RenderInfo(fmt.Sprintf("Share %d of %d", i+1, n), strings.Join(numberedLines(words), "\n")))
+		}
+		return strings.Join(boxes, "\n"), nil
+	}
+}
+
+// CombineEscrow asks for escrow shares until there are enough to unlock the
+// vault. On its own it checks that the shares unlock the vault. With reset,
+// it then sets a new master password, so the keyfile that password is
+// combined with, if any, is checked before any share is asked for.
+func (v *Vault) CombineEscrow(reset bool) error {
+	v.logo()
+	v.title("🤝 Escrow Combine")
+
+	file, err := v.readHeader()
+	if err != nil {
+		return err
+	}
+	if !file.hasKeySlot(SlotEscrow) {
+		return ErrNoEscrowKey
+	}
+	var keyfile []byte
+	if reset {
+		if keyfile, err = v.resetKeyfile(file); err != nil {
+			return err
+		}
+		defer zero(keyfile)
+	}
+
+	var shares []EscrowShare
+	for threshold := 2; len(shares) < threshold; {
+		prompt := "Enter an escrow share"
+		if len(shares) > 0 {
+			prompt = fmt.Sprintf("Enter escrow share %d of %d", len(shares)+1, threshold)
+		}
+		text, err := v.prompter.Password(prompt)
+		if err != nil {
+			return err
+		}
+		share, err := ParseEscrowShare(string(text))
+		zero(text)
+		if err == nil && len(shares) > 0 {
+			err = checkEscrowShare(shares, share)
+		}
+		if err != nil {
+			v.println(ui.RenderError(err.Error()))
+			continue
+		}
+		shares = append(shares, share)
+		threshold = share.Threshold
+	}
+
+	escrow, err := CombineEscrowShares(shares)
+	for _, share := range shares {
+		zero(share.Y)
+	}
+	if err != nil {
+		return err
+	}
+	session, err := OpenKey(v.path, Key{Escrow: escrow})
+	zero(escrow)
+	if errors.Is(err, ErrInvalidPassword) {
+		return errors.New("the escrow shares do not unlock this vault")
+	}
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if !reset {
+		names, err := session.List()
+		if err != nil {
+			return err
+		}
+		v.println(ui.RenderSuccess(fmt.Sprintf("The escrow shares unlock this vault, which holds %d entries.", len(names))))
+		v.println(ui.DimStyle.Render("  Run 'vaulta escrow combine --reset' to choose a new master password with them."))
+		v.println()
+		return nil
+	}
+
+	changed, err := v.resetPassword(session, keyfile)
+	if err != nil || !changed {
+		return err
+	}
+	v.println(ui.DimStyle.Render("  The escrow shares still work. Run 'vaulta escrow split' to replace them if they were exposed."))
+	v.println()
+	return nil
+}
+
+// checkEscrowShare refuses a share that cannot be combined with the ones
+// already entered
+func checkEscrowShare(shares []EscrowShare, share EscrowShare) error {
+	if share.Set != shares[0].Set || share.Threshold != shares[0].Threshold {
+		return errors.New("this share comes from a different split")
+	}
+	for _, s := range shares {
+		if s.X == share.X {
+			return errors.New("this share was already entered")
+		}
+	}
+	return nil
+}
+
+// escrowOutput is the machine readable form of new escrow shares
+type escrowOutput struct {
+	Slot      int        `json:"slot"`
+	Threshold int        `json:"threshold"`
+	Shares    [][]string `json:"shares"`
+}
@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitTestEscrow splits a new escrow key of the vault into 3 shares with a
+// threshold of 2, answering its prompts with answers, and returns the shares
+// as raw lines
+func splitTestEscrow(t *testing.T, v *Vault, answers ...string) []string {
+	t.Helper()
+	v.prompter = NewScriptedPrompter(answers...)
+	v.format = FormatRaw
+	out, err := v.SplitEscrow(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.format = FormatText
+	shares := strings.Split(out, "\n")
+	if len(shares) != 3 {
+		t.Fatalf("SplitEscrow returned %d shares, want 3", len(shares))
+	}
+	return shares
+}
+
+func TestCombineEscrow(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	v := newTestCLI(t, path, nil)
+	shares := splitTestEscrow(t, v, "correct horse")
+
+	// Without reset, the shares only unlock the vault
+	script := NewScriptedPrompter(shares[2], shares[0])
+	v.prompter = script
+	if err := v.CombineEscrow(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Answers) > 0 {
+		t.Errorf("answers left unused: %q", script.Answers)
+	}
+	openEntry(t, path, "correct horse", "github")
+
+	// A share of the same split entered twice is asked again
+	const newPwd = "Tr0ub4dor&3 correct horse battery staple"
+	script = NewScriptedPrompter(shares[1], shares[1], shares[2], newPwd, newPwd)
+	v.prompter = script
+	if err := v.CombineEscrow(true); err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Answers) > 0 {
+		t.Errorf("answers left unused: %q", script.Answers)
+	}
+	if _, err := Open(path, []byte("correct horse")); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Open with the old password returned %v, want %v", err, ErrInvalidPassword)
+	}
+	openEntry(t, path, newPwd, "github")
+	openEntry(t, path, "battery staple", "github")
+}
+
+func TestCombineEscrowWrongSplit(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	v := newTestCLI(t, path, nil)
+	old := splitTestEscrow(t, v, "correct horse")
+	splitTestEscrow(t, v, "correct horse", "y")
+
+	v.prompter = NewScriptedPrompter(old[0], old[1])
+	if err := v.CombineEscrow(false); err == nil || !strings.Contains(err.Error(), "do not unlock") {
+		t.Errorf("CombineEscrow with replaced shares returned %v", err)
+	}
+}
+
+func TestCombineEscrowKeyfileFirst(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vault.json")
+	keyfilePath := filepath.Join(dir, "vault.key")
+	if err := GenerateKeyfile(keyfilePath); err != nil {
+		t.Fatal(err)
+	}
+	keyfile, err := ReadKeyfile(keyfilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := CreateKey(path, Key{Password: []byte("correct horse"), Keyfile: keyfile}, WithKDFParams(testKDFParams))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	v := newTestCLI(t, path, nil)
+	v.keyfile = keyfilePath
+	shares := splitTestEscrow(t, v, "correct horse")
+
+	// Without the keyfile, the reset is refused before any share is typed
+	v.keyfile = ""
+	script := NewScriptedPrompter(shares...)
+	v.prompter = script
+	if err := v.CombineEscrow(true); !errors.Is(err, ErrKeyfileRequired) {
+		t.Fatalf("CombineEscrow without the keyfile returned %v, want %v", err, ErrKeyfileRequired)
+	}
+	if len(script.Prompts) > 0 {
+		t.Errorf("CombineEscrow asked %q before refusing", script.Prompts)
+	}
+
+	// The shares alone still unlock the vault
+	v.prompter = NewScriptedPrompter(shares[0], shares[1])
+	if err := v.CombineEscrow(false); err != nil {
+		t.Errorf("CombineEscrow without reset: %v", err)
+	}
+
+	const newPwd = "Tr0ub4dor&3 correct horse battery staple"
+	v.keyfile = keyfilePath
+	v.prompter = NewScriptedPrompter(shares[0], shares[1], newPwd, newPwd)
+	if err := v.CombineEscrow(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, []byte(newPwd)); err == nil {
+		t.Error("the new password unlocks the vault without the keyfile")
+	}
+	session, err = OpenKey(path, Key{Password: []byte(newPwd), Keyfile: keyfile})
+	if err != nil {
+		t.Fatalf("OpenKey with the new password and the keyfile: %v", err)
+	}
+	session.Close()
+}
+
+func TestCombineEscrowNoEscrowKey(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	script := NewScriptedPrompter()
+	if err := newTestCLI(t, path, script).CombineEscrow(false); !errors.Is(err, ErrNoEscrowKey) {
+		t.Errorf("CombineEscrow returned %v, want %v", err, ErrNoEscrowKey)
+	}
+	if len(script.Prompts) > 0 {
+		t.Errorf("CombineEscrow asked %q", script.Prompts)
+	}
+}
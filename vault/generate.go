@@ -0,0 +1,232 @@
+package vault
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// Character classes of generated passwords. Quotes and backslashes are left
+// out of the symbols so passwords can be pasted into shells and config files.
+const (
+	lowerChars  = "abcdefghijklmnopqrstuvwxyz"
+	upperChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars  = "0123456789"
+	symbolChars = "!#$%&*+-=?@^_~.,:;()[]{}<>/|"
+	// ambiguousChars look alike in many fonts
+	ambiguousChars = "Il1|O0o"
+)
+
+const (
+	// DefaultPasswordLength is the length of generated passwords.
+	DefaultPasswordLength = 20
+	// maxGeneratedLength bounds the length of generated passwords and
+	// passphrases
+	maxGeneratedLength = 1024
+	// minPassphraseWords keeps generated passphrases above 64 bits of
+	// entropy
+	minPassphraseWords = 5
+)
+
+// GenerateOptions describes a secret to generate. With Words set, it is a
+// passphrase of that many words from the EFF large wordlist. Otherwise it is a
+// password of Length characters from the enabled classes, with at least one
+// character of each.
+type GenerateOptions struct {
+	Length  int
+	Lower   bool
+	Upper   bool
+	Digits  bool
+	Symbols bool
+	// ExcludeAmbiguous leaves out characters that look alike, such as l, 1
+	// and I.
+	ExcludeAmbiguous bool
+	Words            int
+	// Separator joins the words of a passphrase.
+	Separator string
+}
+
+// DefaultGenerateOptions returns the options of a DefaultPasswordLength
+// characters password using every character class.
+func DefaultGenerateOptions() GenerateOptions {
+	return GenerateOptions{
+		Length:    DefaultPasswordLength,
+		Lower:     true,
+		Upper:     true,
+		Digits:    true,
+		Symbols:   true,
+		Separator: "-",
+	}
+}
+
+// Generate returns a new random secret and its entropy in bits. The caller
+// should zero the secret once done with it.
+func Generate(opts GenerateOptions) ([]byte, float64, error) {
+	if opts.Words > 0 {
+		return generatePassphrase(opts.Words, opts.Separator)
+	}
+	return generatePassword(opts)
+}
+
+// classes returns the characters of each enabled class
+func (o GenerateOptions) classes() []string {
+	var classes []string
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{{o.Lower, lowerChars}, {o.Upper, upperChars}, {o.Digits, digitChars}, {o.Symbols, symbolChars}} {
+		if !class.enabled {
+			continue
+		}
+		chars := class.chars
+		if o.ExcludeAmbiguous {
+			chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguousChars, r) {
+					return -1
+				}
+				return r
+			}, chars)
+		}
+		classes = append(classes, chars)
+	}
+	return classes
+}
+
+// generatePassword draws one character of each class, fills the rest from
+// all of them and shuffles the result
+func generatePassword(opts GenerateOptions) ([]byte, float64, error) {
+	classes := opts.classes()
+	if len(classes) == 0 {
+		return nil, 0, errors.New("at least one character class is needed")
+	}
+	if opts.Length < len(classes) {
+		return nil, 0, fmt.Errorf("a password using %d character classes needs at least %d characters", len(classes), len(classes))
+	}
+	if opts.Length > maxGeneratedLength {
+		return nil, 0, fmt.Errorf("passwords are limited to %d characters", maxGeneratedLength)
+	}
+
+	pool := strings.Join(classes, "")
+	password := make([]byte, opts.Length)
+	for i := range password {
+		chars := pool
+		if i < len(classes) {
+			chars = classes[i]
+		}
+		n, err := randomIndex(len(chars))
+		if err != nil {
+			zero(password)
+			return nil, 0, err
+		}
+		password[i] = chars[n]
+	}
+	// Fisher-Yates, so the guaranteed characters can be anywhere
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			zero(password)
+			return nil, 0, err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return password, passwordBits(opts.Length, classes), nil
+}
+
+// passwordBits returns the entropy of a password of length characters from
+// classes with at least one of each. The passwords meeting that requirement
+// are counted by inclusion-exclusion over the classes left out.
+func passwordBits(length int, classes []string) float64 {
+	pool := 0
+	for _, class := range classes {
+		pool += len(class)
+	}
+
+	// Fraction of all pool^length strings that use every class
+	fraction := 0.0
+	for subset := 0; subset < 1<<len(classes); subset++ {
+		missing, sign := 0, 1.0
+		for i, class := range classes {
+			if subset>>i&1 == 1 {
+				missing += len(class)
+				sign = -sign
+			}
+		}
+		fraction += sign * math.Pow(1-float64(missing)/float64(pool), float64(length))
+	}
+	return float64(length)*math.Log2(float64(pool)) + math.Log2(fraction)
+}
+
+// generatePassphrase picks words uniformly from passphraseWords
+func generatePassphrase(words int, separator string) ([]byte, float64, error) {
+	if words < minPassphraseWords {
+		return nil, 0, fmt.Errorf("passphrases need at least %d words", minPassphraseWords)
+	}
+	if words > maxGeneratedLength {
+		return nil, 0, fmt.Errorf("passphrases are limited to %d words", maxGeneratedLength)
+	}
+	picked := make([]string, words)
+	for i := range picked {
+		n, err := randomIndex(len(passphraseWords))
+		if err != nil {
+			return nil, 0, err
+		}
+		picked[i] = passphraseWords[n]
+	}
+	passphrase := []byte(strings.Join(picked, separator))
+	return passphrase, float64(words) * math.Log2(float64(len(passphraseWords))), nil
+}
+
+// randomIndex returns a uniformly random integer in [0, n). Random values
+// past the last multiple of n are drawn again so that no result is favored.
+func randomIndex(n int) (int, error) {
+	limit := uint64(1<<32) - uint64(1<<32)%uint64(n)
+	for {
+		b, err := randomBytes(4)
+		if err != nil {
+			return 0, err
+		}
+		if v := uint64(binary.BigEndian.Uint32(b)); v < limit {
+			return int(v % uint64(n)), nil
+		}
+	}
+}
+
+// GenerateSecret generates a secret without touching the vault and returns it
+// formatted for output, with its estimated entropy.
+func (v *Vault) GenerateSecret(opts GenerateOptions) (string, error) {
+	secret, bits, err := Generate(opts)
+	if err != nil {
+		return "", err
+	}
+	defer zero(secret)
+
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(generatedOutput{Secret: string(secret), Bits: math.Floor(bits)})
+	case FormatYAML:
+		return marshalYAML(generatedOutput{Secret: string(secret), Bits: math.Floor(bits)})
+	case FormatRaw:
+		return string(secret), nil
+	default:
+		title := "Generated Password"
+		if opts.Words > 0 {
+			title = "Generated Passphrase"
+		}
+		return ui.RenderInfo(title, string(secret)+"\n\n"+ui.DimStyle.Render(entropyText(bits))), nil
+	}
+}
+
+// generatedOutput is the machine readable form of a generated secret
+type generatedOutput struct {
+	Secret string  `json:"secret"`
+	Bits   float64 `json:"entropy_bits"`
+}
+
+// entropyText describes an entropy estimate
+func entropyText(bits float64) string {
+	return fmt.Sprintf("about %.0f bits of entropy", math.Floor(bits))
+}
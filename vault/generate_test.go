@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPassphraseWords(t *testing.T) {
+	if len(passphraseWords) != 7776 {
+		t.Fatalf("passphrase wordlist holds %d words, want 7776", len(passphraseWords))
+	}
+	seen := make(map[string]bool, len(passphraseWords))
+	for _, word := range passphraseWords {
+		if seen[word] {
+			t.Errorf("%q appears twice in the passphrase wordlist", word)
+		}
+		seen[word] = true
+	}
+	if passphraseWords[0] != "abacus" || passphraseWords[len(passphraseWords)-1] != "zoom" {
+		t.Errorf("passphrase wordlist runs from %q to %q", passphraseWords[0], passphraseWords[len(passphraseWords)-1])
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	passphrase, bits, err := Generate(GenerateOptions{Words: 6, Separator: " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Split(string(passphrase), " ")
+	if len(words) != 6 {
+		t.Fatalf("passphrase %q has %d words, want 6", passphrase, len(words))
+	}
+	for _, word := range words {
+		if !slices.Contains(passphraseWords, word) {
+			t.Errorf("%q is not in the passphrase wordlist", word)
+		}
+	}
+	if want := 6 * math.Log2(7776); math.Abs(bits-want) > 1e-9 {
+		t.Errorf("entropy is %f bits, want %f", bits, want)
+	}
+
+	for _, n := range []int{1, minPassphraseWords - 1, maxGeneratedLength + 1} {
+		if _, _, err := Generate(GenerateOptions{Words: n, Separator: " "}); err == nil {
+			t.Errorf("generating a passphrase of %d words succeeded", n)
+		}
+	}
+}
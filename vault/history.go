@@ -0,0 +1,226 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// Default retention applied when a vault has no policy of its own.
+const defaultHistoryVersions = 10
+
+// ErrVersionNotFound is returned when an entry has no such previous version.
+var ErrVersionNotFound = errors.New("version not found")
+
+// now returns the current time, truncated so timestamps stay readable
+var now = func() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Version is a previous state of an entry, kept when the entry was replaced.
+type Version struct {
+	Entry
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// RetentionPolicy controls how many previous versions of each entry are kept.
+type RetentionPolicy struct {
+	// Versions is the maximum number of versions kept per entry.
+	Versions int `json:"versions"`
+	// MaxAgeDays drops versions replaced more than this many days ago. Zero
+	// keeps versions regardless of age.
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+}
+
+// DefaultRetentionPolicy returns the policy used by vaults that never set one.
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{Versions: defaultHistoryVersions}
+}
+
+// prune drops the versions the policy does not retain. history is ordered
+// newest first.
+func (p RetentionPolicy) prune(history []Version, at time.Time) []Version {
+	if p.MaxAgeDays > 0 {
+		cutoff := at.AddDate(0, 0, -p.MaxAgeDays)
+		for i, version := range history {
+			if version.ReplacedAt.Before(cutoff) {
+				history = history[:i]
+				break
+			}
+		}
+	}
+	if len(history) > p.Versions {
+		history = history[:p.Versions]
+	}
+	if len(history) == 0 {
+		return nil
+	}
+	return history
+}
+
+// sameContent reports whether e and other hold the same values, ignoring
+// their history and timestamps
+func (e Entry) sameContent(other Entry) bool {
+	for _, entry := range []*Entry{&e, &other} {
+		entry.History = nil
+		entry.Created, entry.Modified, entry.Accessed = time.Time{}, time.Time{}, time.Time{}
+	}
+	return reflect.DeepEqual(e, other)
+}
+
+// withHistory returns entry carrying the history of old, with old itself
+// recorded as the most recent previous version
+func withHistory(entry, old Entry, policy RetentionPolicy) Entry {
+	history := old.History
+	if !entry.sameContent(old) {
+		previous := old
+		previous.History = nil
+		history = append([]Version{{Entry: previous, ReplacedAt: now()}}, history...)
+	}
+	entry.History = policy.prune(history, now())
+	return entry
+}
+
+// Retention returns the retention policy of the vault.
+func (s *Session) Retention() RetentionPolicy {
+	if s.data.Retention == nil {
+		return DefaultRetentionPolicy()
+	}
+	return *s.data.Retention
+}
+
+// SetRetention changes the retention policy of the vault. Existing history is
+// pruned on the next Save.
+func (s *Session) SetRetention(policy RetentionPolicy) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	if policy.Versions < 0 || policy.MaxAgeDays < 0 {
+		return errors.New("retention limits cannot be negative")
+	}
+	s.data.Retention = &policy
+	return nil
+}
+
+// History returns the previous versions of an entry, newest first. Version
+// numbers used by Restore start at 1 for the first element.
+func (s *Session) History(name string) ([]Version, error) {
+	entry, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.History, nil
+}
+
+// Restore makes the given previous version the current value of an entry. The
+// value being replaced is kept in the history, so a restore can be undone.
+func (s *Session) Restore(name string, version int) error {
+	history, err := s.History(name)
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > len(history) {
+		return fmt.Errorf("%w: '%s' has %d previous versions", ErrVersionNotFound, name, len(history))
+	}
+	return s.Put(name, history[version-1].Entry)
+}
+
+// pruneHistory applies the retention policy to every entry
+func (s *Session) pruneHistory() {
+	policy := s.Retention()
+	for name, entry := range s.data.Entries {
+		entry.History = policy.prune(entry.History, now())
+		s.data.Entries[name] = entry
+	}
+}
+
+func (v *Vault) EntryHistory(name string) (string, error) {
+	v.logo()
+	v.title("🕘 Entry History")
+
+	session, err := v.unlock()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	history, err := session.History(name)
+	if errors.Is(err, ErrEntryNotFound) {
+		return "", entryNotFound(session, name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return v.formatHistory(name, history)
+}
+
+func (v *Vault) RestoreEntry(name string, version int) error {
+	v.logo()
+	v.title("⏪ Restore Entry")
+
+	session, err := v.unlock()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if err := session.Restore(name, version); err != nil {
+		if errors.Is(err, ErrEntryNotFound) {
+			return entryNotFound(session, name)
+		}
+		return err
+	}
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Entry '%s' restored to version %d!", name, version)))
+	v.println()
+	return nil
+}
+
+// ConfigureRetention updates the fields of the retention policy that are not
+// nil and reports the resulting policy.
+func (v *Vault) ConfigureRetention(versions, maxAgeDays *int) error {
+	v.logo()
+	v.title("🕘 History Retention")
+
+	session, err := v.unlock()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	policy := session.Retention()
+	if versions != nil || maxAgeDays != nil {
+		if versions != nil {
+			policy.Versions = *versions
+		}
+		if maxAgeDays != nil {
+			policy.MaxAgeDays = *maxAgeDays
+		}
+		if err := session.SetRetention(policy); err != nil {
+			return err
+		}
+		if err := session.Save(); err != nil {
+			return err
+		}
+	}
+
+	maxAge := "unlimited"
+	if policy.MaxAgeDays > 0 {
+		maxAge = strconv.Itoa(policy.MaxAgeDays) + " days"
+	}
+	v.println(ui.RenderInfo("Retention policy", fmt.Sprintf(
+		"%s %d\n%s %s",
+		ui.EntryLabelStyle.Render("Versions:"), policy.Versions,
+		ui.EntryLabelStyle.Render("Max age:"), maxAge,
+	)))
+	v.println()
+	return nil
+}
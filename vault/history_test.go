@@ -0,0 +1,139 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// passwords returns the passwords of history, newest first
+func passwords(history []Version) []string {
+	var out []string
+	for _, version := range history {
+		out = append(out, version.Password)
+	}
+	return out
+}
+
+// putPasswords stores each password in turn as the entry called name
+func putPasswords(t *testing.T, s *Session, name string, pws ...string) {
+	t.Helper()
+	for _, pw := range pws {
+		if err := s.Put(name, Entry{Username: "me", Password: pw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHistoryDefaultRetention(t *testing.T) {
+	session := newTestSession(t, nil)
+	if got := session.Retention(); got != (RetentionPolicy{Versions: 10}) {
+		t.Errorf("default retention is %+v, want 10 versions", got)
+	}
+
+	var pws []string
+	for i := range 12 {
+		pws = append(pws, fmt.Sprintf("pw%d", i))
+	}
+	putPasswords(t, session, "github", pws...)
+	// Saving the same values again adds no version
+	putPasswords(t, session, "github", "pw11")
+
+	history, err := session.History("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pw10", "pw9", "pw8", "pw7", "pw6", "pw5", "pw4", "pw3", "pw2", "pw1"}
+	if got := passwords(history); !slices.Equal(got, want) {
+		t.Errorf("history is %q, want %q", got, want)
+	}
+	if _, err := session.History("gitlab"); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("History of a missing entry returned %v, want %v", err, ErrEntryNotFound)
+	}
+}
+
+func TestHistoryCustomRetention(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	versions, maxAge := 3, 30
+	if err := newTestCLI(t, path, NewScriptedPrompter("correct horse")).ConfigureRetention(&versions, &maxAge); err != nil {
+		t.Fatal(err)
+	}
+	// Fields left out keep their value
+	versions = 2
+	if err := newTestCLI(t, path, NewScriptedPrompter("correct horse")).ConfigureRetention(&versions, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if got, want := session.Retention(), (RetentionPolicy{Versions: 2, MaxAgeDays: 30}); got != want {
+		t.Errorf("retention is %+v, want %+v", got, want)
+	}
+
+	putPasswords(t, session, "github", "a", "b", "c")
+	history, _ := session.History("github")
+	if got := passwords(history); !slices.Equal(got, []string{"b", "a"}) {
+		t.Errorf("history is %q, want the 2 newest versions", got)
+	}
+
+	// Versions older than the maximum age are dropped
+	defer func(orig func() time.Time) { now = orig }(now)
+	start := now()
+	now = func() time.Time { return start.AddDate(0, 0, 31) }
+	putPasswords(t, session, "github", "d")
+	history, _ = session.History("github")
+	if got := passwords(history); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("history is %q, want only the version replaced today", got)
+	}
+
+	if err := session.SetRetention(RetentionPolicy{Versions: -1}); err == nil {
+		t.Error("SetRetention accepted a negative number of versions")
+	}
+	if err := session.SetRetention(RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := session.History("github"); len(history) > 0 {
+		t.Errorf("history is %q with no versions retained", passwords(history))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	session := newTestSession(t, nil)
+	putPasswords(t, session, "github", "a", "b", "c")
+
+	if err := session.Restore("github", 2); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := session.Get("github")
+	if entry.Password != "a" {
+		t.Errorf("restored password is %q, want a", entry.Password)
+	}
+	// The replaced value becomes the newest version, so the restore can be
+	// undone
+	if got := passwords(entry.History); !slices.Equal(got, []string{"c", "b", "a"}) {
+		t.Errorf("history after restoring is %q, want [c b a]", got)
+	}
+	if err := session.Restore("github", 1); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := session.Get("github"); entry.Password != "c" {
+		t.Errorf("password after undoing the restore is %q, want c", entry.Password)
+	}
+
+	for _, version := range []int{0, 5} {
+		if err := session.Restore("github", version); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Restore of version %d returned %v, want %v", version, err, ErrVersionNotFound)
+		}
+	}
+	if err := session.Restore("gitlab", 1); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Restore of a missing entry returned %v, want %v", err, ErrEntryNotFound)
+	}
+}
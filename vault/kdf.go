@@ -0,0 +1,236 @@
+package vault
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+	"golang.org/x/crypto/argon2"
+)
+
+// Bounds accepted for Argon2id parameters, both when creating a vault and when
+// reading one, so a damaged header cannot make unlocking allocate unbounded
+// memory.
+const (
+	minKDFMemory uint32 = 8 * 1024
+	maxKDFMemory uint32 = 4 * 1024 * 1024
+	maxKDFTime   uint32 = 64
+)
+
+// KDFParams are the Argon2id cost parameters used to derive the vault key.
+type KDFParams struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the amount of memory used, in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultKDFParams returns the parameters used for new vaults.
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Time: kdfIterations, Memory: kdfMemory, Threads: kdfParallelism}
+}
+
+// Validate checks that the parameters are within the supported bounds.
+func (p KDFParams) Validate() error {
+	switch {
+	case p.Time < 1 || p.Time > maxKDFTime:
+		return fmt.Errorf("KDF time must be between 1 and %d, got %d", maxKDFTime, p.Time)
+	case p.Memory < minKDFMemory || p.Memory > maxKDFMemory:
+		return fmt.Errorf("KDF memory must be between %d and %d MiB, got %d KiB", minKDFMemory/1024, maxKDFMemory/1024, p.Memory)
+	case p.Threads < 1:
+		return errors.New("KDF threads must be at least 1")
+	}
+	return nil
+}
+
+// Weak reports whether the parameters are cheaper than the defaults.
+func (p KDFParams) Weak() bool {
+	def := DefaultKDFParams()
+	return p.Memory < def.Memory || p.Time < def.Time
+}
+
+func (p KDFParams) String() string {
+	return fmt.Sprintf("time=%d memory=%dMiB threads=%d", p.Time, p.Memory/1024, p.Threads)
+}
+
+// newKDFConfig records the salt and Argon2id parameters used to derive a key
+func newKDFConfig(salt []byte, params KDFParams) KDFConfig {
+	return KDFConfig{
+		Algorithm:   "argon2id",
+		Salt:        base64.StdEncoding.EncodeToString(salt),
+		Iterations:  params.Time,
+		Memory:      params.Memory,
+		Parallelism: params.Threads,
+	}
+}
+
+// params returns the Argon2id parameters stored in the vault header
+func (c KDFConfig) params() KDFParams {
+	return KDFParams{Time: c.Iterations, Memory: c.Memory, Threads: c.Parallelism}
+}
+
+// deriveKey derives an encryption key from a password and salt using Argon2id
+func deriveKey(password, salt []byte, params KDFParams) []byte {
+	return argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, kdfKeyLength)
+}
+
+// CalibrateKDF benchmarks Argon2id on this machine and returns parameters for
+// which deriving a key takes about target, using at most maxMemory KiB, along
+// with the measured duration.
+func CalibrateKDF(target time.Duration, maxMemory uint32) (KDFParams, time.Duration) {
+	params := KDFParams{
+		Time:    1,
+		Memory:  max(min(maxMemory, maxKDFMemory), minKDFMemory),
+		Threads: uint8(min(runtime.NumCPU(), 4)),
+	}
+	salt := make([]byte, saltSize)
+	measure := func(p KDFParams) time.Duration {
+		start := time.Now()
+		deriveKey([]byte("calibration"), salt, p)
+		return time.Since(start)
+	}
+
+	// Trade memory for time until a single pass fits the target
+	elapsed := measure(params)
+	for elapsed > target && params.Memory/2 >= minKDFMemory {
+		params.Memory /= 2
+		elapsed = measure(params)
+	}
+
+	// Then add passes while they still fit
+	for params.Time < maxKDFTime {
+		perPass := elapsed / time.Duration(params.Time)
+		if elapsed+perPass > target {
+			break
+		}
+		params.Time++
+		elapsed = measure(params)
+	}
+	return params, elapsed
+}
+
+// KDFParams returns the key derivation parameters of the key slot that
+// unlocked the session.
+func (s *Session) KDFParams() KDFParams {
+	return s.unlockedSlot().KDF.params()
+}
+
+// Rekey re-wraps the data key in the key slot that unlocked the session, with
+// a key derived from passphrase using params and a fresh salt. A slot that
+// needs a keyfile keeps the one the session was unlocked with, and passphrase
+// is ignored for keyfile only slots. The payload is not re-encrypted. Changes
+// are written by the next Save.
+func (s *Session) Rekey(passphrase []byte, params KDFParams) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	current := s.unlockedSlot()
+	if !current.needsPassword() && !current.needsKeyfile() {
+		return fmt.Errorf("the %s key slot cannot be rekeyed, replace it instead", current.Type)
+	}
+	var key Key
+	if current.needsPassword() {
+		key.Password = passphrase
+	}
+	if current.needsKeyfile() {
+		key.Keyfile = s.keyfile
+	}
+	slot, err := newKeySlot(current.ID, key, s.key, params, s.file.Cipher.Algorithm)
+	if err != nil {
+		return err
+	}
+	s.file.KeySlots[s.slot] = slot
+	return nil
+}
+
+func (v *Vault) ShowKDF() error {
+	v.logo()
+	v.title("⚙️  Key Derivation")
+
+	session, err := v.unlock()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	params := session.KDFParams()
+	v.println(ui.RenderInfo("Argon2id parameters", kdfRows(params)))
+	v.println()
+	return nil
+}
+
+// CalibrateKDF benchmarks this machine and prints parameters that hit target.
+// With apply, the vault is rekeyed with them.
+func (v *Vault) CalibrateKDF(target time.Duration, maxMemory uint32, apply bool) error {
+	v.logo()
+	v.title("⚙️  Calibrate Key Derivation")
+
+	params, elapsed := CalibrateKDF(target, maxMemory)
+	v.println(ui.RenderInfo("Suggested parameters", fmt.Sprintf(
+		"%s\n%s %s\n\n%s",
+		kdfRows(params),
+		ui.EntryLabelStyle.Render("Unlock time:"), elapsed.Round(time.Millisecond),
+		ui.DimStyle.Render(fmt.Sprintf("Use them with: vaulta init --kdf-time %d --kdf-memory %d --kdf-threads %d", params.Time, params.Memory/1024, params.Threads)),
+	)))
+	v.println()
+
+	if !apply {
+		return nil
+	}
+	return v.rekey(params)
+}
+
+// UpgradeKDF rekeys the vault with params.
+func (v *Vault) UpgradeKDF(params KDFParams) error {
+	v.logo()
+	v.title("⚙️  Upgrade Key Derivation")
+
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	return v.rekey(params)
+}
+
+// rekey unlocks the vault and re-wraps its key slot with params
+func (v *Vault) rekey(params KDFParams) error {
+	session, masterPwd, err := v.unlockWithPassword()
+	if err != nil {
+		return err
+	}
+	defer zero(masterPwd)
+	defer session.Close()
+
+	old := session.KDFParams()
+	if err := session.Rekey(masterPwd, params); err != nil {
+		return err
+	}
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Vault rekeyed from %s to %s", old, params)))
+	v.println()
+	return nil
+}
+
+// kdfRows renders params as labelled rows
+func kdfRows(params KDFParams) string {
+	rows := fmt.Sprintf(
+		"%s %d\n%s %d MiB\n%s %d",
+		ui.EntryLabelStyle.Render("Time:"), params.Time,
+		ui.EntryLabelStyle.Render("Memory:"), params.Memory/1024,
+		ui.EntryLabelStyle.Render("Threads:"), params.Threads,
+	)
+	if params.Weak() {
+		rows += "\n\n" + ui.ErrorStyle.Render("Weaker than the defaults, run 'vaulta kdf upgrade'")
+	}
+	return rows
+}
@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// keyfileSize is the number of random bytes in a generated keyfile
+const keyfileSize = 32
+
+var (
+	// ErrKeyfileRequired is returned when every key slot of the vault needs
+	// a keyfile and none was supplied.
+	ErrKeyfileRequired = errors.New("a keyfile is required to unlock this vault")
+	// ErrPasswordRequired is returned when every key slot of the vault needs
+	// a password and none was supplied.
+	ErrPasswordRequired = errors.New("a password is required to unlock this vault")
+)
+
+// Key holds the factors supplied to unlock a vault or protect a key slot.
+// Keyfile is the SHA-256 digest of the keyfile, as returned by ReadKeyfile.
+// Recovery is a recovery key, as returned by ParseRecoveryKey, and Escrow an
+// escrow key, as returned by CombineEscrowShares. Neither can be combined
+// with other factors.
+type Key struct {
+	Password []byte
+	Keyfile  []byte
+	Recovery []byte
+	Escrow   []byte
+}
+
+// factors returns the set of factors supplied in k
+func (k Key) factors() factor {
+	var f factor
+	if len(k.Password) > 0 {
+		f |= factorPassword
+	}
+	if k.Keyfile != nil {
+		f |= factorKeyfile
+	}
+	if k.Recovery != nil {
+		f |= factorRecovery
+	}
+	if k.Escrow != nil {
+		f |= factorEscrow
+	}
+	return f
+}
+
+// slotType returns the type of the key slot protected by the factors of k
+func (k Key) slotType() (string, error) {
+	switch {
+	case k.Recovery != nil && k.factors() != factorRecovery:
+		return "", errors.New("a recovery key cannot be combined with other factors")
+	case k.Recovery != nil:
+		return SlotRecovery, nil
+	case k.Escrow != nil && k.factors() != factorEscrow:
+		return "", errors.New("an escrow key cannot be combined with other factors")
+	case k.Escrow != nil:
+		return SlotEscrow, nil
+	case len(k.Password) > 0 && k.Keyfile != nil:
+		return SlotPasswordKeyfile, nil
+	case len(k.Password) > 0:
+		return SlotPassword, nil
+	case k.Keyfile != nil:
+		return SlotKeyfile, nil
+	}
+	return "", errors.New("a key slot needs a password, a keyfile or both")
+}
+
+// composite returns the secret a key slot of type slotType derives its key
+// from. Like KeePass, a password and a keyfile are combined by hashing them
+// together.
+func (k Key) composite(slotType string) []byte {
+	switch slotType {
+	case SlotPassword:
+		return k.Password
+	case SlotKeyfile:
+		return k.Keyfile
+	case SlotRecovery:
+		return k.Recovery
+	case SlotEscrow:
+		return k.Escrow
+	}
+	password := sha256.Sum256(k.Password)
+	h := sha256.New()
+	h.Write(password[:])
+	h.Write(k.Keyfile)
+	return h.Sum(nil)
+}
+
+// zero wipes the factors held by k
+func (k Key) zero() {
+	zero(k.Password)
+	zero(k.Keyfile)
+	zero(k.Recovery)
+	zero(k.Escrow)
+}
+
+// WithKeyfile makes the vault use the keyfile at path as an unlock factor,
+// along with or instead of the master password.
+func WithKeyfile(path string) Option {
+	return func(v *Vault) {
+		v.keyfile = path
+	}
+}
+
+// ReadKeyfile returns the SHA-256 digest of the keyfile at path. Any file can
+// be used as a keyfile, but it must not be modified afterwards.
+func ReadKeyfile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("keyfile %s is empty", path)
+	}
+	return h.Sum(nil), nil
+}
+
+// GenerateKeyfile writes a new random keyfile at path, refusing to overwrite
+// an existing file.
+func GenerateKeyfile(path string) error {
+	key, err := randomBytes(keyfileSize)
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkFactors fails early with an explicit error when no key slot can be
+// unlocked with the supplied factors. Files before version 3 only have a
+// password.
+func (v *VaultFile) checkFactors(have factor) error {
+	slots := v.KeySlots
+	if len(slots) == 0 {
+		slots = []KeySlot{{Type: SlotPassword}}
+	}
+
+	needsKeyfile := false
+	for _, slot := range slots {
+		if slot.satisfiedBy(have) {
+			return nil
+		}
+		if slot.needsKeyfile() && have&factorKeyfile == 0 {
+			needsKeyfile = true
+		}
+	}
+	switch {
+	case have&factorRecovery != 0:
+		return ErrNoRecoveryKey
+	case have&factorEscrow != 0:
+		return ErrNoEscrowKey
+	case needsKeyfile:
+		return ErrKeyfileRequired
+	}
+	return ErrPasswordRequired
+}
+
+// usesPassword reports whether any key slot is unlocked with a password
+func (v *VaultFile) usesPassword() bool {
+	if len(v.KeySlots) == 0 {
+		return true
+	}
+	for _, slot := range v.KeySlots {
+		if slot.needsPassword() {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Vault) GenerateKeyfile(path string) error {
+	v.logo()
+	v.title("🗝️  Generate Keyfile")
+
+	if err := GenerateKeyfile(path); err != nil {
+		return err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Keyfile written to %s", path)))
+	v.println(ui.RenderWarning("Keep a backup of this keyfile. A vault that requires it cannot be unlocked without it, and it must never be modified."))
+	v.println()
+	return nil
+}
@@ -0,0 +1,397 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// dataKeySize is the size of the random key that encrypts the payload
+const dataKeySize = 32
+
+// Key slot types, naming the factors needed to unlock them.
+const (
+	SlotPassword        = "password"
+	SlotKeyfile         = "keyfile"
+	SlotPasswordKeyfile = "password+keyfile"
+	SlotRecovery        = "recovery"
+	SlotEscrow          = "escrow"
+)
+
+// factor is a set of the secrets a key slot is unlocked with
+type factor int
+
+const (
+	factorPassword factor = 1 << iota
+	factorKeyfile
+	factorRecovery
+	factorEscrow
+)
+
+// ErrKeySlotNotFound is returned when a key slot does not exist.
+var ErrKeySlotNotFound = errors.New("key slot not found")
+
+// KeySlot holds the data encryption key of the vault, wrapped by a key
+// encryption key derived from one unlock method. Any slot can unlock the
+// vault, similar to LUKS keyslots.
+type KeySlot struct {
+	ID    int       `json:"id"`
+	Type  string    `json:"type"`
+	KDF   KDFConfig `json:"kdf"`
+	Nonce string    `json:"nonce"`
+	Key   string    `json:"key"`
+}
+
+// KeySlotInfo describes a key slot without its key material.
+type KeySlotInfo struct {
+	ID   int
+	Type string
+	KDF  KDFParams
+	// Unlocked is set for the slot that unlocked the session.
+	Unlocked bool
+}
+
+// additionalData returns the slot metadata authenticated along with the
+// wrapped key, so a slot's KDF parameters cannot be lowered unnoticed
+func (k *KeySlot) additionalData(cipherAlgorithm string) []byte {
+	header := struct {
+		ID     int       `json:"id"`
+		Type   string    `json:"type"`
+		KDF    KDFConfig `json:"kdf"`
+		Cipher string    `json:"cipher"`
+	}{k.ID, k.Type, k.KDF, cipherAlgorithm}
+
+	data, _ := json.Marshal(header)
+	return data
+}
+
+// factors returns the factors needed to unlock the slot
+func (k *KeySlot) factors() factor {
+	switch k.Type {
+	case SlotPassword:
+		return factorPassword
+	case SlotKeyfile:
+		return factorKeyfile
+	case SlotPasswordKeyfile:
+		return factorPassword | factorKeyfile
+	case SlotRecovery:
+		return factorRecovery
+	case SlotEscrow:
+		return factorEscrow
+	}
+	return 0
+}
+
+// needsPassword reports whether the slot is unlocked with a password
+func (k *KeySlot) needsPassword() bool {
+	return k.factors()&factorPassword != 0
+}
+
+// needsKeyfile reports whether the slot is unlocked with a keyfile
+func (k *KeySlot) needsKeyfile() bool {
+	return k.factors()&factorKeyfile != 0
+}
+
+// satisfiedBy reports whether the supplied factors are enough to try the slot
+func (k *KeySlot) satisfiedBy(have factor) bool {
+	need := k.factors()
+	return need != 0 && have&need == need
+}
+
+// deriveKEK derives the key encryption key of the slot from the factors of key
+func (k *KeySlot) deriveKEK(key Key) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(k.KDF.Salt)
+	if err != nil {
+		return nil, err
+	}
+	secret := key.composite(k.Type)
+	if k.Type == SlotPasswordKeyfile {
+		defer zero(secret)
+	}
+	return deriveKey(secret, salt, k.KDF.params()), nil
+}
+
+// wrap encrypts the data key with kek into the slot
+func (k *KeySlot) wrap(kek, dataKey []byte, cipherAlgorithm string) error {
+	nonce, wrapped, err := encrypt(cipherAlgorithm, kek, dataKey, k.additionalData(cipherAlgorithm))
+	if err != nil {
+		return err
+	}
+	k.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	k.Key = base64.StdEncoding.EncodeToString(wrapped)
+	return nil
+}
+
+// unwrap decrypts the data key held by the slot with kek
+func (k *KeySlot) unwrap(kek []byte, cipherAlgorithm string) ([]byte, error) {
+	nonce, err := base64.StdEncoding.DecodeString(k.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(cipherAlgorithm, kek, nonce, wrapped, k.additionalData(cipherAlgorithm))
+}
+
+// newKeySlot wraps dataKey in a new slot unlocked by the factors of key
+func newKeySlot(id int, key Key, dataKey []byte, params KDFParams, cipherAlgorithm string) (KeySlot, error) {
+	slotType, err := key.slotType()
+	if err != nil {
+		return KeySlot{}, err
+	}
+	salt, err := randomBytes(saltSize)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	slot := KeySlot{ID: id, Type: slotType, KDF: newKDFConfig(salt, params)}
+
+	kek, err := slot.deriveKEK(key)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	defer zero(kek)
+	if err := slot.wrap(kek, dataKey, cipherAlgorithm); err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// unlockSlot tries key against every slot it has the factors for and returns
+// the data key along with the index of the slot that held it
+func (v *VaultFile) unlockSlot(key Key) ([]byte, int, error) {
+	for i := range v.KeySlots {
+		slot := &v.KeySlots[i]
+		if !slot.satisfiedBy(key.factors()) {
+			continue
+		}
+		kek, err := slot.deriveKEK(key)
+		if err != nil {
+			return nil, -1, err
+		}
+		dataKey, err := slot.unwrap(kek, v.Cipher.Algorithm)
+		zero(kek)
+		if err == nil {
+			return dataKey, i, nil
+		}
+	}
+	return nil, -1, ErrInvalidPassword
+}
+
+// unlockedSlot returns the key slot that unlocked the session
+func (s *Session) unlockedSlot() *KeySlot {
+	return &s.file.KeySlots[s.slot]
+}
+
+// nextSlotID returns an ID not used by any slot
+func (v *VaultFile) nextSlotID() int {
+	id := 0
+	for _, slot := range v.KeySlots {
+		id = max(id, slot.ID)
+	}
+	return id + 1
+}
+
+// KeySlots describes the key slots of the vault.
+func (s *Session) KeySlots() []KeySlotInfo {
+	infos := make([]KeySlotInfo, 0, len(s.file.KeySlots))
+	for i, slot := range s.file.KeySlots {
+		infos = append(infos, KeySlotInfo{
+			ID:       slot.ID,
+			Type:     slot.Type,
+			KDF:      slot.KDF.params(),
+			Unlocked: i == s.slot,
+		})
+	}
+	return infos
+}
+
+// AddKeySlot adds a key slot that unlocks the vault with the factors of key
+// and returns its ID. The payload is not re-encrypted. Changes are written by
+// the next Save.
+func (s *Session) AddKeySlot(key Key, params KDFParams) (int, error) {
+	if s.key == nil {
+		return 0, ErrClosed
+	}
+	if err := params.Validate(); err != nil {
+		return 0, err
+	}
+	slot, err := newKeySlot(s.file.nextSlotID(), key, s.key, params, s.file.Cipher.Algorithm)
+	if err != nil {
+		return 0, err
+	}
+	s.file.KeySlots = append(s.file.KeySlots, slot)
+	return slot.ID, nil
+}
+
+// hasKeySlot reports whether the vault has a key slot of slotType
+func (s *Session) hasKeySlot(slotType string) bool {
+	return s.file.hasKeySlot(slotType)
+}
+
+// hasKeySlot reports whether the vault file has a key slot of slotType
+func (v *VaultFile) hasKeySlot(slotType string) bool {
+	for _, slot := range v.KeySlots {
+		if slot.Type == slotType {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceKeySlots adds a key slot for key, removing the other slots of the
+// same type, and returns its ID
+func (s *Session) replaceKeySlots(key Key, params KDFParams) (int, error) {
+	slotType, err := key.slotType()
+	if err != nil {
+		return 0, err
+	}
+	var old []int
+	for _, slot := range s.file.KeySlots {
+		if slot.Type == slotType {
+			old = append(old, slot.ID)
+		}
+	}
+	id, err := s.AddKeySlot(key, params)
+	if err != nil {
+		return 0, err
+	}
+	for _, oldID := range old {
+		if err := s.RemoveKeySlot(oldID); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// RemoveKeySlot removes the key slot with the given ID. The slot used to
+// unlock the session cannot be removed. Changes are written by the next Save.
+func (s *Session) RemoveKeySlot(id int) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	for i, slot := range s.file.KeySlots {
+		if slot.ID != id {
+			continue
+		}
+		if i == s.slot {
+			return errors.New("cannot remove the key slot used to unlock the vault, unlock it with another one first")
+		}
+		s.file.KeySlots = append(s.file.KeySlots[:i:i], s.file.KeySlots[i+1:]...)
+		if i < s.slot {
+			s.slot--
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrKeySlotNotFound, id)
+}
+
+func (v *Vault) ListKeySlots() (string, error) {
+	v.logo()
+	v.title("🗝️  Key Slots")
+
+	session, err := v.unlock()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var rows [][]string
+	for _, slot := range session.KeySlots() {
+		unlocked := ""
+		if slot.Unlocked {
+			unlocked = ui.IconCheck
+		}
+		rows = append(rows, []string{strconv.Itoa(slot.ID), slot.Type, slot.KDF.String(), unlocked})
+	}
+	return ui.RenderTable("Key Slots", []string{"ID", "Type", "Key derivation", "Unlocked"}, rows), nil
+}
+
+// AddKeySlot adds a key slot unlocked by a new password, the keyfile at
+// keyfile when set, or both. noPassword adds a keyfile only slot.
+func (v *Vault) AddKeySlot(keyfile string, noPassword bool) error {
+	if noPassword && keyfile == "" {
+		return errors.New("a key slot without a password needs a keyfile")
+	}
+
+	v.logo()
+	v.title("🗝️  Add Key Slot")
+
+	session, err := v.unlock()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var key Key
+	defer key.zero()
+	if keyfile != "" {
+		if key.Keyfile, err = ReadKeyfile(keyfile); err != nil {
+			return err
+		}
+	}
+	if !noPassword {
+		key.Password, err = v.chooseNewPassword("Choose a password for the new key slot")
+		if err != nil {
+			return err
+		}
+		if key.Password == nil {
+			v.println(ui.RenderInfo("Info", "No key slot added."))
+			return nil
+		}
+	}
+
+	id, err := session.AddKeySlot(key, session.KDFParams())
+	if err != nil {
+		return err
+	}
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Key slot %d added, the vault can now also be unlocked with %s.", id, describeSlot(session.KeySlots()[len(session.KeySlots())-1].Type))))
+	v.println()
+	return nil
+}
+
+func (v *Vault) RemoveKeySlot(id int) error {
+	v.logo()
+	v.title("🗝️  Remove Key Slot")
+
+	session, err := v.unlock()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if err := session.RemoveKeySlot(id); err != nil {
+		return err
+	}
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Key slot %d removed.", id)))
+	v.println()
+	return nil
+}
+
+// describeSlot names the factors needed to unlock a key slot of slotType
+func describeSlot(slotType string) string {
+	switch slotType {
+	case SlotPassword:
+		return "the new password"
+	case SlotKeyfile:
+		return "the keyfile alone"
+	case SlotRecovery:
+		return "the recovery key"
+	case SlotEscrow:
+		return "the escrow shares"
+	}
+	return "the new password and the keyfile"
+}
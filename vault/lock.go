@@ -0,0 +1,135 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// lockTimeout is how long opening a vault waits for another vaulta
+	// process to release it
+	lockTimeout = 10 * time.Second
+	// lockPollInterval is how often a locked vault is tried again
+	lockPollInterval = 50 * time.Millisecond
+)
+
+var (
+	// ErrVaultChanged is returned when saving a vault that another process
+	// changed since it was read. It can only happen where file locking is
+	// not supported, or with processes that ignore the lock.
+	ErrVaultChanged = errors.New("the vault was changed by another process, run the command again")
+
+	// errLockHeld and errLockUnsupported are returned by tryLock
+	errLockHeld        = errors.New("lock held by another process")
+	errLockUnsupported = errors.New("file locking is not supported")
+)
+
+// LockedError is returned when a vault is still locked by another process
+// once the lock timeout expires.
+type LockedError struct {
+	// PID is the process holding the lock, or 0 if it is not known
+	PID int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return "vault is locked by another process"
+	}
+	return fmt.Sprintf("vault is locked by pid %d", e.PID)
+}
+
+// fileLock is an exclusive advisory lock on a vault, held from reading the
+// vault to writing it back. It is taken on a lock file next to the vault,
+// since the vault file itself is replaced on every write.
+type fileLock struct {
+	f *os.File
+}
+
+// lockVault takes the lock of the vault at path, waiting for up to timeout.
+// Where locking is not supported, or the vault is read-only, it returns a nil
+// lock and no error, leaving Save to detect concurrent changes by the file
+// hash.
+func lockVault(path string, timeout time.Duration) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	lockPath := path + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if errors.Is(err, os.ErrPermission) || isReadOnlyFS(err) {
+		// Reading a vault that cannot be written is safe without the lock,
+		// since writes replace the file atomically. A lock file that belongs
+		// to someone else next to a writable vault must not turn locking off.
+		if !canWrite(path) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot lock the vault: %w. If %s was left by another user, for example by running vaulta with sudo, remove it", err, lockPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, errLockUnsupported) {
+			f.Close()
+			return nil, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			f.Close()
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			pid := lockOwner(f)
+			f.Close()
+			return nil, &LockedError{PID: pid}
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// Record the owner for the processes waiting on the lock. This is only
+	// informative, so failures are ignored.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &fileLock{f: f}, nil
+}
+
+// canWrite reports whether the file at path may be opened for writing. A
+// missing file may be created, so it counts as writable.
+func canWrite(path string) bool {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return !errors.Is(err, os.ErrPermission) && !isReadOnlyFS(err)
+	}
+	f.Close()
+	return true
+}
+
+// lockOwner returns the process ID recorded in the lock file, or 0
+func lockOwner(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// release drops the lock. The lock file is left in place, removing it would
+// let two processes lock different files.
+func (l *fileLock) release() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package vault
+
+import "os"
+
+// tryLock is not supported on this platform
+func tryLock(f *os.File) error {
+	return errLockUnsupported
+}
+
+// isReadOnlyFS reports whether err is caused by a read-only file system
+func isReadOnlyFS(err error) bool {
+	return false
+}
@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockVaultTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	lock, err := lockVault(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil {
+		t.Skip("file locking is not supported here")
+	}
+
+	start := time.Now()
+	_, err = lockVault(path, 100*time.Millisecond)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("locking a held lock returned %v, want a LockedError", err)
+	}
+	if locked.PID != os.Getpid() {
+		t.Errorf("lock owner is pid %d, want %d", locked.PID, os.Getpid())
+	}
+	if want := "vault is locked by pid"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not mention %q", err, want)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("gave up after %s, before the timeout", waited)
+	}
+
+	if err := lock.release(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := lockVault(path, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("locking a released lock: %v", err)
+	}
+	again.release()
+}
+
+func TestSessionHoldsLock(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	session, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.lock == nil {
+		session.Close()
+		t.Skip("file locking is not supported here")
+	}
+
+	// The lock is held from reading the vault until the session is closed,
+	// across saves
+	if err := session.Put("gitlab", Entry{Password: "gl"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatal(err)
+	}
+	var locked *LockedError
+	if _, err := lockVault(path, 100*time.Millisecond); !errors.As(err, &locked) {
+		t.Errorf("locking a vault held by a session returned %v, want a LockedError", err)
+	}
+
+	session.Close()
+	session, err = Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Open after Close: %v", err)
+	}
+	session.Close()
+}
+
+func TestSaveDetectsOutsideChange(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	session, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	// A process ignoring the lock rewrites the vault
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.Put("gitlab", Entry{Password: "gl"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); !errors.Is(err, ErrVaultChanged) {
+		t.Errorf("Save after an outside change returned %v, want %v", err, ErrVaultChanged)
+	}
+	if current, _ := os.ReadFile(path); string(current) != string(data)+"\n" {
+		t.Error("Save overwrote the outside change")
+	}
+}
+
+func TestLockVaultForeignLockFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions do not apply to root")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vault.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A lock file this user cannot open, as left by running vaulta with sudo
+	if err := os.WriteFile(path+".lock", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lockVault(path, 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "remove it") {
+		t.Errorf("locking with a foreign lock file returned %v, want an error", err)
+	}
+
+	// A vault that cannot be written either is read without the lock
+	if err := os.Chmod(path, 0400); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err := lockVault(path, 100*time.Millisecond); err != nil || lock != nil {
+		t.Errorf("locking a read-only vault returned %v, %v, want no lock and no error", lock, err)
+	}
+}
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// currentVersion is the vault file format written by this version of vaulta.
+const currentVersion = 3
+
+// ErrUnsupportedVersion is returned for vault files written by a newer
+// version of vaulta.
+var ErrUnsupportedVersion = errors.New("unsupported vault file version")
+
+// fileMigrations upgrade a vault file from the version used as key to the
+// next one. They may use the passphrase to decrypt and re-encrypt the payload.
+var fileMigrations = map[int]func(file *VaultFile, passphrase []byte) error{
+	1: migrateVersion1,
+	2: migrateVersion2,
+}
+
+// checkVersion refuses vault files this version of vaulta cannot read
+func (v *VaultFile) checkVersion() error {
+	if v.Version > currentVersion {
+		return fmt.Errorf("%w: the vault was written with format version %d, this version of vaulta only supports up to %d, please upgrade vaulta", ErrUnsupportedVersion, v.Version, currentVersion)
+	}
+	if v.Version < 1 {
+		return fmt.Errorf("%w: invalid format version %d", ErrUnsupportedVersion, v.Version)
+	}
+	// Key slots replaced the single KDF block in version 3, a mismatch means
+	// the version was tampered with
+	if (v.Version < 3) != (len(v.KeySlots) == 0) {
+		return fmt.Errorf("%w: the layout of the vault does not match format version %d", ErrUnsupportedVersion, v.Version)
+	}
+	return nil
+}
+
+// migrate upgrades file in memory to currentVersion, one version at a time
+func (v *VaultFile) migrate(passphrase []byte) error {
+	for v.Version < currentVersion {
+		from := v.Version
+		if err := fileMigrations[from](v, passphrase); err != nil {
+			return fmt.Errorf("migrating vault from format version %d: %w", from, err)
+		}
+		if v.Version != from+1 {
+			return fmt.Errorf("migrating vault from format version %d: ended at version %d", from, v.Version)
+		}
+	}
+	return nil
+}
+
+// backupPath returns where the copy of a vault file is kept before it is
+// migrated away from version
+func backupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// backupVaultFile copies the vault file at path to backupPath
+func backupVaultFile(path string, version int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backupPath(path, version), data, 0600)
+}
+
+// migrateVersion1 re-encrypts the payload so the vault header is
+// authenticated as additional data
+func migrateVersion1(file *VaultFile, passphrase []byte) error {
+	key, plaintext, err := file.decryptLegacy(passphrase)
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	defer zero(plaintext)
+
+	file.Version = 2
+	nonce, ciphertext, err := encrypt(file.Cipher.Algorithm, key, plaintext, file.additionalData())
+	if err != nil {
+		return err
+	}
+	file.updateCipher(nonce, ciphertext)
+	return nil
+}
+
+// migrateVersion2 moves to envelope encryption: the payload is re-encrypted
+// with a random data key, which is wrapped in a password key slot. The slot
+// reuses the existing salt and KDF parameters, so the key already derived
+// from the passphrase becomes its key encryption key.
+func migrateVersion2(file *VaultFile, passphrase []byte) error {
+	key, plaintext, err := file.decryptLegacy(passphrase)
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	defer zero(plaintext)
+
+	dataKey, err := randomBytes(dataKeySize)
+	if err != nil {
+		return err
+	}
+	defer zero(dataKey)
+
+	slot := KeySlot{ID: 1, Type: SlotPassword, KDF: *file.KDF}
+	if err := slot.wrap(key, dataKey, file.Cipher.Algorithm); err != nil {
+		return err
+	}
+
+	file.Version = 3
+	file.KDF = nil
+	file.KeySlots = []KeySlot{slot}
+	nonce, ciphertext, err := encrypt(file.Cipher.Algorithm, dataKey, plaintext, file.additionalData())
+	if err != nil {
+		return err
+	}
+	file.updateCipher(nonce, ciphertext)
+	return nil
+}
+
+// decryptLegacy decrypts files before version 3 with the key derived from
+// the passphrase and the file's single KDF block
+func (v *VaultFile) decryptLegacy(passphrase []byte) (key, plaintext []byte, err error) {
+	if v.KDF == nil {
+		return nil, nil, errors.New("missing key derivation parameters")
+	}
+	salt, err := base64.StdEncoding.DecodeString(v.KDF.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, ciphertext, err := v.decodeCipher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key = deriveKey(passphrase, salt, v.KDF.params())
+	plaintext, err = decrypt(v.Cipher.Algorithm, key, nonce, ciphertext, v.additionalData())
+	if err != nil {
+		zero(key)
+		return nil, nil, err
+	}
+	return key, plaintext, nil
+}
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// The fixtures in testdata were written by the versions of vaulta that
+// introduced each format: version 1 by the first release, version 2 when the
+// header became authenticated and version 3 with key slots. Each holds a
+// github entry.
+var migrationFixtures = []struct {
+	version  int
+	password string
+	entry    Entry
+}{
+	{1, "fixture-v1-pass", Entry{Username: "me@example.com", Password: "gh-s3cret"}},
+	{2, "fixture-v2-pass", Entry{Username: "me@example.com", Password: "gh-s3cret", URLs: []string{"https://github.com"}, Tags: []string{"work"}}},
+	{3, "fixture-v3-pass", Entry{Username: "me@example.com", Password: "gh-s3cret", URLs: []string{"https://github.com"}, Tags: []string{"work"}}},
+}
+
+// copyFixture copies a vault fixture to a temporary directory
+func copyFixture(t *testing.T, version int) (path string, original []byte) {
+	t.Helper()
+	original, err := os.ReadFile(filepath.Join("testdata", fixtureName(version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(t.TempDir(), "vault.json")
+	if err := os.WriteFile(path, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, original
+}
+
+// fixtureName returns the name of the fixture of version in testdata
+func fixtureName(version int) string {
+	return fmt.Sprintf("vault-v%d.json", version)
+}
+
+func TestOpenMigratesFixtures(t *testing.T) {
+	for _, fixture := range migrationFixtures {
+		t.Run(fixtureName(fixture.version), func(t *testing.T) {
+			path, original := copyFixture(t, fixture.version)
+
+			session, err := Open(path, []byte(fixture.password))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFixtureEntry(t, session, fixture.entry)
+			session.Close()
+
+			file, _, err := readVaultFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Version != currentVersion {
+				t.Errorf("vault file has version %d after Open, want %d", file.Version, currentVersion)
+			}
+
+			backup, err := os.ReadFile(backupPath(path, fixture.version))
+			switch {
+			case fixture.version == currentVersion:
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("a current vault was backed up: %v", err)
+				}
+			case err != nil:
+				t.Errorf("no backup of the version %d file: %v", fixture.version, err)
+			case !bytes.Equal(backup, original):
+				t.Errorf("backup of the version %d file differs from the original", fixture.version)
+			}
+
+			// The upgraded vault opens again without migrating
+			session, err = Open(path, []byte(fixture.password))
+			if err != nil {
+				t.Fatalf("reopening the upgraded vault: %v", err)
+			}
+			checkFixtureEntry(t, session, fixture.entry)
+			session.Close()
+		})
+	}
+}
+
+func checkFixtureEntry(t *testing.T, session *Session, want Entry) {
+	t.Helper()
+	got, err := session.Get("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != want.Username || got.Password != want.Password ||
+		!slices.Equal(got.URLs, want.URLs) || !slices.Equal(got.Tags, want.Tags) {
+		t.Errorf("github entry is %+v, want %+v", got, want)
+	}
+}
+
+func TestOpenFixtureWrongPassword(t *testing.T) {
+	for _, fixture := range migrationFixtures {
+		path, original := copyFixture(t, fixture.version)
+		if _, err := Open(path, []byte("wrong")); !errors.Is(err, ErrInvalidPassword) {
+			t.Errorf("version %d: Open with a wrong password returned %v, want %v", fixture.version, err, ErrInvalidPassword)
+		}
+		if current, _ := os.ReadFile(path); !bytes.Equal(current, original) {
+			t.Errorf("version %d: a failed unlock changed the vault file", fixture.version)
+		}
+	}
+}
+
+func TestOpenUnversionedFile(t *testing.T) {
+	path, original := copyFixture(t, 1)
+	unversioned := bytes.Replace(original, []byte(`"version": 1,`), nil, 1)
+	if err := os.WriteFile(path, unversioned, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, []byte("fixture-v1-pass")); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Open of a file without a version returned %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
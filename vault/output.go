@@ -0,0 +1,424 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// Format selects how command results are written.
+type Format string
+
+const (
+	// FormatText renders results with the styled ui boxes.
+	FormatText Format = "text"
+	// FormatJSON writes results as indented JSON.
+	FormatJSON Format = "json"
+	// FormatYAML writes results as YAML.
+	FormatYAML Format = "yaml"
+	// FormatRaw writes only the bare values, e.g. the secret of an entry.
+	FormatRaw Format = "raw"
+)
+
+// WithOutputFormat sets the format results are returned in. For anything but
+// FormatText, the logo and titles are suppressed and status messages go to
+// stderr so stdout can be piped into other programs.
+func WithOutputFormat(format Format) Option {
+	return func(v *Vault) {
+		v.format = format
+	}
+}
+
+// entryOutput is the machine readable form of an entry
+type entryOutput struct {
+	Name     string    `json:"name"`
+	Username string    `json:"username"`
+	Secret   string    `json:"secret,omitempty"`
+	URLs     []string  `json:"urls,omitempty"`
+	Notes    string    `json:"notes,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Fields   []Field   `json:"fields,omitempty"`
+	TOTP     string    `json:"totp,omitempty"`
+	Created  time.Time `json:"created,omitzero"`
+	Modified time.Time `json:"modified,omitzero"`
+	Accessed time.Time `json:"accessed,omitzero"`
+}
+
+// newEntryOutput converts entry for output. Without withSecret, the password
+// and the values of hidden fields are left out.
+func newEntryOutput(name string, entry Entry, withSecret bool) entryOutput {
+	out := entryOutput{
+		Name:     name,
+		Username: entry.Username,
+		URLs:     entry.URLs,
+		Notes:    entry.Notes,
+		Tags:     entry.Tags,
+		Created:  entry.Created,
+		Modified: entry.Modified,
+		Accessed: entry.Accessed,
+	}
+	for _, field := range entry.Fields {
+		if field.Type == FieldHidden && !withSecret {
+			field.Value = ""
+		}
+		out.Fields = append(out.Fields, field)
+	}
+	if withSecret {
+		out.Secret = entry.Password
+		out.TOTP = entry.TOTP
+	}
+	return out
+}
+
+// entryRows returns the rows shown below the username and password of an
+// entry in text mode. Hidden fields are masked unless show is set.
+func entryRows(entry Entry, show bool) []ui.Row {
+	var rows []ui.Row
+	if len(entry.URLs) > 0 {
+		rows = append(rows, ui.Row{Label: "URLs", Value: strings.Join(entry.URLs, "\n")})
+	}
+	if entry.Notes != "" {
+		rows = append(rows, ui.Row{Label: "Notes", Value: entry.Notes})
+	}
+	if len(entry.Tags) > 0 {
+		rows = append(rows, ui.Row{Label: "Tags", Value: strings.Join(entry.Tags, ", ")})
+	}
+	for _, field := range entry.Fields {
+		value := field.Value
+		if !show {
+			value = displayValue(field)
+		}
+		rows = append(rows, ui.Row{Label: field.Name, Value: value})
+	}
+	if entry.TOTP != "" {
+		rows = append(rows, ui.Row{Label: "TOTP", Value: currentCode(entry.TOTP)})
+	}
+	if !entry.Modified.IsZero() {
+		rows = append(rows, ui.Row{Label: "Modified", Value: entry.Modified.Local().Format(time.DateTime)})
+	}
+	return rows
+}
+
+// currentCode describes the current one-time password of a TOTP secret. It
+// is shown even when secrets are masked, since it expires within seconds.
+func currentCode(secret string) string {
+	totp, err := ParseTOTP(secret)
+	if err != nil {
+		return "invalid secret"
+	}
+	at := now()
+	code, err := totp.Code(at)
+	if err != nil {
+		return "invalid secret"
+	}
+	return fmt.Sprintf("%s (valid for %s)", code, totp.Remaining(at))
+}
+
+// formatEntry formats a single entry. The machine readable formats always
+// include its secret, the text rendering only with show, since it tends to
+// end up in terminal scrollback.
+func (v *Vault) formatEntry(name string, entry Entry, show bool) (string, error) {
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(newEntryOutput(name, entry, true))
+	case FormatYAML:
+		return marshalYAML(newEntryOutput(name, entry, true))
+	case FormatRaw:
+		return entry.Password, nil
+	default:
+		password := entry.Password
+		if !show {
+			password = maskedSecret
+		}
+		return ui.RenderEntry(name, entry.Username, password, entryRows(entry, show)...), nil
+	}
+}
+
+// versionOutput is the machine readable form of a previous entry version
+type versionOutput struct {
+	Version    int       `json:"version"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	entryOutput
+}
+
+// formatHistory formats the previous versions of an entry. Secrets are
+// masked in text mode.
+func (v *Vault) formatHistory(name string, history []Version) (string, error) {
+	out := make([]versionOutput, 0, len(history))
+	for i, version := range history {
+		out = append(out, versionOutput{
+			Version:     i + 1,
+			ReplacedAt:  version.ReplacedAt,
+			entryOutput: newEntryOutput(name, version.Entry, true),
+		})
+	}
+
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(out)
+	case FormatYAML:
+		return marshalYAML(out)
+	case FormatRaw:
+		var lines []string
+		for _, version := range out {
+			lines = append(lines, fmt.Sprintf("%d\t%s\t%s", version.Version, version.ReplacedAt.Format(time.RFC3339), version.Username))
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		var rows [][]string
+		for _, version := range out {
+			rows = append(rows, []string{
+				strconv.Itoa(version.Version),
+				version.ReplacedAt.Local().Format(time.DateTime),
+				version.Username,
+				maskedSecret,
+			})
+		}
+		return ui.RenderTable(fmt.Sprintf("History of %s", name), []string{"Version", "Replaced", "Username", "Secret"}, rows), nil
+	}
+}
+
+// formatList formats the given entries without their secrets, in the order
+// of names
+func (v *Vault) formatList(title string, names []string, entries map[string]Entry) (string, error) {
+	out := make([]entryOutput, 0, len(names))
+	for _, name := range names {
+		out = append(out, newEntryOutput(name, entries[name], false))
+	}
+
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(out)
+	case FormatYAML:
+		return marshalYAML(out)
+	case FormatRaw:
+		return strings.Join(names, "\n"), nil
+	default:
+		return ui.RenderList(title, names), nil
+	}
+}
+
+// decorated reports whether logos and titles should be printed
+func (v *Vault) decorated() bool {
+	return v.format == "" || v.format == FormatText
+}
+
+// status returns where status messages are written
+func (v *Vault) status() io.Writer {
+	if v.decorated() {
+		return v.stdout
+	}
+	return v.stderr
+}
+
+// println writes a status line
+func (v *Vault) println(a ...any) {
+	fmt.Fprintln(v.status(), a...)
+}
+
+// logo prints the vaulta logo in text mode
+func (v *Vault) logo() {
+	if v.decorated() {
+		v.println(ui.RenderLogo())
+	}
+}
+
+// title prints a command title in text mode
+func (v *Vault) title(title string) {
+	if v.decorated() {
+		v.println(ui.TitleStyle.Render(title))
+		v.println()
+	}
+}
+
+func marshalJSON(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// marshalYAML renders v as block style YAML. It goes through encoding/json so
+// field names and omitempty behave exactly like the JSON output.
+func marshalYAML(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeYAMLNode(dec)
+	if err != nil {
+		return "", err
+	}
+
+	switch node := node.(type) {
+	case yamlMap, yamlList:
+		if lines := yamlLines(node, 0); len(lines) > 0 {
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+	return yamlInline(node), nil
+}
+
+type (
+	yamlScalar string
+	yamlList   []yamlNode
+	yamlMap    []yamlField
+	yamlNode   any
+)
+
+type yamlField struct {
+	key   string
+	value yamlNode
+}
+
+// decodeYAMLNode reads the next JSON value from dec, keeping object key order
+func decodeYAMLNode(dec *json.Decoder) (yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			list := yamlList{}
+			for dec.More() {
+				item, err := decodeYAMLNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			_, err := dec.Token()
+			return list, err
+		}
+
+		m := yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, yamlField{key: key.(string), value: value})
+		}
+		_, err := dec.Token()
+		return m, err
+	case string:
+		return yamlScalar(yamlString(tok)), nil
+	case json.Number:
+		return yamlScalar(tok.String()), nil
+	case bool:
+		return yamlScalar(fmt.Sprint(tok)), nil
+	default:
+		return yamlScalar("null"), nil
+	}
+}
+
+// yamlLines renders a map or list as block YAML lines at the given indent
+func yamlLines(node yamlNode, indent int) []string {
+	pad := strings.Repeat(" ", indent)
+	var lines []string
+
+	switch node := node.(type) {
+	case yamlMap:
+		for _, field := range node {
+			if isYAMLBlock(field.value) {
+				lines = append(lines, pad+yamlString(field.key)+":")
+				lines = append(lines, yamlLines(field.value, indent+2)...)
+			} else {
+				lines = append(lines, pad+yamlString(field.key)+": "+yamlInline(field.value))
+			}
+		}
+	case yamlList:
+		for _, item := range node {
+			if isYAMLBlock(item) {
+				child := yamlLines(item, indent+2)
+				child[0] = pad + "- " + strings.TrimPrefix(child[0], pad+"  ")
+				lines = append(lines, child...)
+			} else {
+				lines = append(lines, pad+"- "+yamlInline(item))
+			}
+		}
+	}
+	return lines
+}
+
+// isYAMLBlock reports whether node must be written as an indented block
+func isYAMLBlock(node yamlNode) bool {
+	switch node := node.(type) {
+	case yamlMap:
+		return len(node) > 0
+	case yamlList:
+		return len(node) > 0
+	}
+	return false
+}
+
+// yamlInline renders a scalar or an empty collection on a single line
+func yamlInline(node yamlNode) string {
+	switch node := node.(type) {
+	case yamlMap:
+		return "{}"
+	case yamlList:
+		return "[]"
+	case yamlScalar:
+		return string(node)
+	}
+	return "null"
+}
+
+var yamlPlain = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./@+-]*$`)
+
+// yamlString returns s as a plain scalar when that is unambiguous, and double
+// quoted otherwise. JSON string escapes are valid in YAML double quotes, but
+// JSON leaves some characters unescaped that YAML does not allow, such as
+// DEL and the C1 controls, so those are escaped too.
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "y", "n", "~":
+	default:
+		if yamlPlain.MatchString(s) {
+			return s
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	var quoted strings.Builder
+	for _, r := range strings.TrimSuffix(buf.String(), "\n") {
+		if yamlPrintable(r) {
+			quoted.WriteRune(r)
+		} else {
+			fmt.Fprintf(&quoted, `\u%04X`, r)
+		}
+	}
+	return quoted.String()
+}
+
+// yamlPrintable reports whether r may appear unescaped in a YAML double
+// quoted scalar. NEL is printable but would be read as a line break.
+func yamlPrintable(r rune) bool {
+	switch {
+	case r == 0x85, r == 0xFEFF:
+		return false
+	case r >= 0x20 && r <= 0x7E, r >= 0xA0 && r <= 0xD7FF, r >= 0xE000 && r <= 0xFFFD, r >= 0x10000:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkYAMLRoundTrip parses the YAML output of v with a real YAML parser and
+// compares it with the JSON output of v
+func checkYAMLRoundTrip(t *testing.T, v any) {
+	t.Helper()
+	out, err := marshalYAML(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed any
+	if err := yaml.Unmarshal([]byte(out), &parsed); err != nil {
+		t.Fatalf("parsing the YAML output: %v\n%s", err, out)
+	}
+	got, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("YAML output parses as\n%s\nwant\n%s\nYAML:\n%s", got, want, out)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	tests := map[string]string{
+		"github":            "github",
+		"me@example.com":    "me@example.com",
+		"a/b-c_d.e+f":       "a/b-c_d.e+f",
+		"":                  `""`,
+		"yes":               `"yes"`,
+		"No":                `"No"`,
+		"ON":                `"ON"`,
+		"y":                 `"y"`,
+		"true":              `"true"`,
+		"null":              `"null"`,
+		"Null":              `"Null"`,
+		"~":                 `"~"`,
+		"0123":              `"0123"`,
+		"1e3":               `"1e3"`,
+		"12:30":             `"12:30"`,
+		"key: value":        `"key: value"`,
+		"pass#word":         `"pass#word"`,
+		"# comment":         `"# comment"`,
+		"- item":            `"- item"`,
+		"[a]":               `"[a]"`,
+		"{a}":               `"{a}"`,
+		"&anchor":           `"&anchor"`,
+		"*alias":            `"*alias"`,
+		"!tag":              `"!tag"`,
+		"'quoted'":          `"'quoted'"`,
+		`"quoted"`:          `"\"quoted\""`,
+		"trailing ":         `"trailing "`,
+		"two\nlines":        `"two\nlines"`,
+		"tab\there":         `"tab\there"`,
+		"héllo":             `"héllo"`,
+		"https://x.org/?a=": `"https://x.org/?a="`,
+		"<b>&amp;":          `"<b>&amp;"`,
+		"del\x7f":           `"del\u007F"`,
+		"nel\u0085":         `"nel\u0085"`,
+		"bom\ufeff":         `"bom\uFEFF"`,
+		"ls\u2028":          `"ls\u2028"`,
+	}
+	for input, want := range tests {
+		if got := yamlString(input); got != want {
+			t.Errorf("yamlString(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestMarshalYAMLRoundTrip(t *testing.T) {
+	tricky := []string{
+		"", "yes", "no", "null", "~", "true", "0123", "1.5", "0x1F", ".inf",
+		"key: value", "pass#word", "- dash", "tab\there", "two\nlines", `back\slash`,
+		"héllo wörld", "日本語", "emoji 🔑", "<html> & co", "del\x7fchar", "c1\u0085char",
+		"line\u2028separator", "%percent", "@at", "`tick", "|pipe", ">fold",
+	}
+	for _, s := range tricky {
+		checkYAMLRoundTrip(t, entryOutput{Name: s, Username: s, Secret: s, Notes: s, Tags: []string{s}})
+	}
+
+	// Nested lists of maps, empty collections and scalars
+	checkYAMLRoundTrip(t, []entryOutput{})
+	checkYAMLRoundTrip(t, map[string]any{"empty_list": []string{}, "empty_map": map[string]string{}, "n": 3, "b": false, "nil": nil})
+	checkYAMLRoundTrip(t, [][]string{{"a", "b"}, {}, {"c"}})
+	checkYAMLRoundTrip(t, []map[string][]map[string]string{{"inner": {{"k": "v"}, {}}}})
+	checkYAMLRoundTrip(t, "yes")
+	checkYAMLRoundTrip(t, 42)
+}
+
+func TestMarshalYAMLEntry(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	entry := Entry{
+		Username: "me@example.com",
+		Password: "s3cret: #1",
+		URLs:     []string{"https://github.com"},
+		Notes:    "first line\nsecond line",
+		Tags:     []string{"work", "yes"},
+		Fields: []Field{
+			{Name: "pin", Type: FieldHidden, Value: "0042"},
+			{Name: "email", Type: FieldEmail, Value: "me@example.com"},
+		},
+		Created:  at,
+		Modified: at,
+	}
+	got, err := marshalYAML(newEntryOutput("github", entry, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name: github
+username: me@example.com
+secret: "s3cret: #1"
+urls:
+  - "https://github.com"
+notes: "first line\nsecond line"
+tags:
+  - work
+  - "yes"
+fields:
+  - name: pin
+    type: hidden
+    value: "0042"
+  - name: email
+    type: email
+    value: me@example.com
+created: "2024-05-01T12:30:00Z"
+modified: "2024-05-01T12:30:00Z"`
+	if got != want {
+		t.Errorf("entry YAML is\n%s\nwant\n%s", got, want)
+	}
+	checkYAMLRoundTrip(t, newEntryOutput("github", entry, true))
+
+	// Without the secret, hidden values are empty and the secret is left out
+	got, err = marshalYAML(newEntryOutput("github", Entry{Username: "me", Password: "s3cret"}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name: github\nusername: me"; got != want {
+		t.Errorf("entry YAML without secret is\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMarshalYAMLHistory(t *testing.T) {
+	v := &Vault{format: FormatYAML}
+	history := []Version{
+		{Entry: Entry{Username: "me", Password: "old"}, ReplacedAt: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{Entry: Entry{Username: "", Password: "older", Tags: []string{}}, ReplacedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	got, err := v.formatHistory("github", history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `- version: 1
+  replaced_at: "2024-05-02T00:00:00Z"
+  name: github
+  username: me
+  secret: old
+- version: 2
+  replaced_at: "2024-05-01T00:00:00Z"
+  name: github
+  username: ""
+  secret: older`
+	if got != want {
+		t.Errorf("history YAML is\n%s\nwant\n%s", got, want)
+	}
+
+	if got, err := v.formatHistory("github", nil); err != nil || got != "[]" {
+		t.Errorf("empty history YAML is %q, %v, want []", got, err)
+	}
+}
+
+func TestMarshalYAMLEscrow(t *testing.T) {
+	out := escrowOutput{Slot: 3, Threshold: 2, Shares: [][]string{{"able", "acid"}, {"aged", "also"}}}
+	got, err := marshalYAML(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `slot: 3
+threshold: 2
+shares:
+  - - able
+    - acid
+  - - aged
+    - also`
+	if got != want {
+		t.Errorf("escrow YAML is\n%s\nwant\n%s", got, want)
+	}
+	checkYAMLRoundTrip(t, out)
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// ErrNoPasswordSlot is returned when changing the password of a vault that
+// was unlocked by a keyfile alone.
+var ErrNoPasswordSlot = errors.New("the key slot used to unlock the vault has no password")
+
+// ChangePassphrase re-wraps the data key of the key slot that unlocked the
+// session under a new passphrase, with a fresh salt and the current KDF
+// parameters, and atomically replaces the vault file. The payload itself is
+// left untouched.
+func (s *Session) ChangePassphrase(passphrase []byte) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	if !s.unlockedSlot().needsPassword() {
+		return ErrNoPasswordSlot
+	}
+	if err := s.Rekey(passphrase, s.KDFParams()); err != nil {
+		return err
+	}
+	return s.write(true)
+}
+
+func (v *Vault) ChangePassword() error {
+	v.logo()
+	v.title("🔑 Change Master Password")
+
+	session, oldPwd, err := v.unlockWithPassword()
+	if err != nil {
+		return err
+	}
+	zero(oldPwd)
+	defer session.Close()
+	if !session.unlockedSlot().needsPassword() {
+		return ErrNoPasswordSlot
+	}
+
+	newPwd, err := v.chooseNewPassword("Choose a new master password")
+	if err != nil {
+		return err
+	}
+	if newPwd == nil {
+		v.println(ui.RenderInfo("Info", "Master password unchanged."))
+		return nil
+	}
+	defer zero(newPwd)
+
+	if err := session.ChangePassphrase(newPwd); err != nil {
+		return err
+	}
+
+	v.println(ui.RenderSuccess("Master password changed successfully!"))
+	v.println()
+	return nil
+}
+
+// chooseNewPassword prompts for a new password, checks its strength and asks
+// for it a second time. It returns nil if the user declines a weak password.
+func (v *Vault) chooseNewPassword(prompt string) ([]byte, error) {
+	newPwd, err := v.prompter.Password(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	weak, err := checkNewPassword(newPwd)
+	if err != nil {
+		zero(newPwd)
+		return nil, err
+	}
+	if weak {
+		v.println(ui.RenderWarning("This password is easy to guess. A longer password mixing letters, digits and symbols, or a passphrase of several words, is much stronger."))
+		useAnyway, err := v.prompter.Confirm("Use it anyway?")
+		if err != nil || !useAnyway {
+			zero(newPwd)
+			return nil, err
+		}
+	}
+
+	confirmPwd, err := v.prompter.Password("Confirm the new password")
+	if err != nil {
+		zero(newPwd)
+		return nil, err
+	}
+	defer zero(confirmPwd)
+	if subtle.ConstantTimeCompare(newPwd, confirmPwd) != 1 {
+		zero(newPwd)
+		return nil, errors.New("passwords do not match")
+	}
+	return newPwd, nil
+}
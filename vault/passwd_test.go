@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChooseNewPassword(t *testing.T) {
+	const strong = "Tr0ub4dor&3 correct horse battery staple"
+	tests := []struct {
+		name    string
+		answers []string
+		want    string
+		// err is part of the expected error message
+		err string
+	}{
+		{"strong", []string{strong, strong}, strong, ""},
+		{"mismatch", []string{strong, strong + "!"}, "", "do not match"},
+		{"too short", []string{"short"}, "", ErrWeakPassword.Error()},
+		{"weak declined", []string{"aaaaaaaa", "n"}, "", ""},
+		{"weak accepted", []string{"aaaaaaaa", "y", "aaaaaaaa"}, "aaaaaaaa", ""},
+		{"weak mismatch", []string{"aaaaaaaa", "y", "aaaaaaab"}, "", "do not match"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := NewScriptedPrompter(test.answers...)
+			got, err := newTestCLI(t, "", script).chooseNewPassword("Choose a new master password")
+			if (err == nil) != (test.err == "") || err != nil && !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("chooseNewPassword returned %v, want an error containing %q", err, test.err)
+			}
+			if string(got) != test.want {
+				t.Errorf("chooseNewPassword returned %q, want %q", got, test.want)
+			}
+			if len(script.Answers) > 0 {
+				t.Errorf("answers left unused: %q", script.Answers)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	const newPwd = "Tr0ub4dor&3 correct horse battery staple"
+	script := NewScriptedPrompter("correct horse", newPwd, newPwd)
+	if err := newTestCLI(t, path, script).ChangePassword(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, []byte("correct horse")); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Open with the old password returned %v, want %v", err, ErrInvalidPassword)
+	}
+	openEntry(t, path, newPwd, "github")
+	// Only the slot that was unlocked changes
+	openEntry(t, path, "battery staple", "github")
+
+	// Running out of answers cancels the change
+	err := newTestCLI(t, path, NewScriptedPrompter(newPwd)).ChangePassword()
+	if !errors.Is(err, ErrNoAnswer) {
+		t.Errorf("ChangePassword without a new password returned %v, want %v", err, ErrNoAnswer)
+	}
+}
@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// MasterPasswordEnv is the environment variable read by PasswordFromEnv.
+const MasterPasswordEnv = "VAULTA_MASTER_PASSWORD"
+
+// PasswordSource supplies the master password without prompting.
+type PasswordSource func() ([]byte, error)
+
+// WithPasswordSource makes the vault read the master password from src
+// instead of prompting for it.
+func WithPasswordSource(src PasswordSource) Option {
+	return func(v *Vault) {
+		v.passwordSource = src
+	}
+}
+
+// PasswordFromFD reads the master password from the first line of the open
+// file descriptor fd.
+func PasswordFromFD(fd int) PasswordSource {
+	return func() ([]byte, error) {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+		if f == nil {
+			return nil, fmt.Errorf("invalid password file descriptor %d", fd)
+		}
+		defer f.Close()
+		return readPasswordLine(f)
+	}
+}
+
+// PasswordFromFile reads the master password from the first line of the file
+// at path. Files readable by the group or by other users are refused.
+func PasswordFromFile(path string) PasswordSource {
+	return func() ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+			return nil, fmt.Errorf("password file %s is accessible by other users (mode %04o), run 'chmod 600 %s' first", path, perm, path)
+		}
+		return readPasswordLine(f)
+	}
+}
+
+// PasswordFromEnv reads the master password from MasterPasswordEnv and
+// removes the variable so it is not inherited by child processes.
+func PasswordFromEnv() PasswordSource {
+	return func() ([]byte, error) {
+		pwd, ok := os.LookupEnv(MasterPasswordEnv)
+		if !ok {
+			return nil, fmt.Errorf("%s is not set", MasterPasswordEnv)
+		}
+		os.Unsetenv(MasterPasswordEnv)
+		if pwd == "" {
+			return nil, fmt.Errorf("%s is empty", MasterPasswordEnv)
+		}
+		return []byte(pwd), nil
+	}
+}
+
+// masterPassword returns the master password from the configured source, or
+// prompts for it when there is none
+func (v *Vault) masterPassword(prompt string) ([]byte, error) {
+	if v.passwordSource != nil {
+		return v.passwordSource()
+	}
+	return v.prompter.Password(prompt)
+}
+
+// readPasswordLine reads a single line from r without the line terminator
+func readPasswordLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if len(line) == 0 {
+		return nil, errors.New("master password is empty")
+	}
+	return line, nil
+}
@@ -0,0 +1,237 @@
+package vault
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/armadi1809/vaulta/ui"
+	"github.com/mattn/go-isatty"
+)
+
+// ErrNoAnswer is returned by ScriptedPrompter when it runs out of answers.
+var ErrNoAnswer = errors.New("no scripted answer left")
+
+// Prompter asks the user for the input the interactive commands need.
+type Prompter interface {
+	// Password asks for a secret without echoing it.
+	Password(prompt string) ([]byte, error)
+	// Text asks for a single line of regular text.
+	Text(prompt, icon string) (string, error)
+	// Confirm asks a yes/no question.
+	Confirm(prompt string) (bool, error)
+	// EditPassword asks for a secret, offering value as the current one.
+	EditPassword(prompt string, value []byte) ([]byte, error)
+	// EditText asks for a line of text, offering value as the current one.
+	EditText(prompt, icon, value string) (string, error)
+}
+
+// DefaultPrompter returns the Bubble Tea prompter when stdin and stdout are
+// both terminals, and a line based prompter on stderr otherwise.
+func DefaultPrompter() Prompter {
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) && os.Getenv("TERM") != "dumb" {
+		return TUIPrompter{}
+	}
+	return NewLinePrompter(os.Stdin, os.Stderr)
+}
+
+// TUIPrompter prompts using the Bubble Tea inputs from the ui package.
+type TUIPrompter struct{}
+
+func (TUIPrompter) Password(prompt string) ([]byte, error) {
+	pwd, err := ui.PromptPassword(prompt)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pwd), nil
+}
+
+func (TUIPrompter) Text(prompt, icon string) (string, error) {
+	return ui.PromptText(prompt, icon)
+}
+
+func (TUIPrompter) Confirm(prompt string) (bool, error) {
+	text, err := ui.PromptText(prompt+" (y/n)", ui.IconWarning)
+	if err != nil {
+		return false, err
+	}
+	return isYes(text), nil
+}
+
+func (TUIPrompter) EditPassword(prompt string, value []byte) ([]byte, error) {
+	pwd, err := ui.EditPassword(prompt, string(value))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pwd), nil
+}
+
+func (TUIPrompter) EditText(prompt, icon, value string) (string, error) {
+	return ui.EditText(prompt, icon, value)
+}
+
+// LinePrompter reads answers one line at a time. It is meant for dumb
+// terminals and for input piped from other programs.
+type LinePrompter struct {
+	in  *bufio.Reader
+	fd  *os.File
+	out io.Writer
+}
+
+// NewLinePrompter returns a prompter reading answers from in and writing
+// prompts to out.
+func NewLinePrompter(in io.Reader, out io.Writer) *LinePrompter {
+	p := &LinePrompter{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		p.fd = f
+	}
+	return p
+}
+
+func (p *LinePrompter) Password(prompt string) ([]byte, error) {
+	fmt.Fprintf(p.out, "%s: ", prompt)
+	if p.fd != nil {
+		if err := setEcho(p.fd, false); err == nil {
+			defer func() {
+				setEcho(p.fd, true)
+				fmt.Fprintln(p.out)
+			}()
+		}
+	}
+	line, err := p.readLine()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(line), nil
+}
+
+func (p *LinePrompter) Text(prompt, icon string) (string, error) {
+	fmt.Fprintf(p.out, "%s: ", prompt)
+	return p.readLine()
+}
+
+func (p *LinePrompter) Confirm(prompt string) (bool, error) {
+	fmt.Fprintf(p.out, "%s [y/N]: ", prompt)
+	text, err := p.readLine()
+	if err != nil {
+		return false, err
+	}
+	return isYes(text), nil
+}
+
+// EditPassword keeps value when an empty line is entered
+func (p *LinePrompter) EditPassword(prompt string, value []byte) ([]byte, error) {
+	pwd, err := p.Password(prompt + " (leave empty to keep)")
+	if err != nil {
+		return nil, err
+	}
+	if len(pwd) == 0 {
+		return value, nil
+	}
+	return pwd, nil
+}
+
+// EditText keeps value when an empty line is entered
+func (p *LinePrompter) EditText(prompt, icon, value string) (string, error) {
+	fmt.Fprintf(p.out, "%s [%s]: ", prompt, value)
+	text, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return value, nil
+	}
+	return text, nil
+}
+
+func (p *LinePrompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if errors.Is(err, io.EOF) && line == "" {
+		return "", errors.New("cancelled")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ScriptedPrompter answers prompts from a fixed list, in order. It records the
+// prompts it was asked so tests can assert on them.
+type ScriptedPrompter struct {
+	Answers []string
+	Prompts []string
+}
+
+// NewScriptedPrompter returns a prompter that replies with answers in order.
+func NewScriptedPrompter(answers ...string) *ScriptedPrompter {
+	return &ScriptedPrompter{Answers: answers}
+}
+
+func (p *ScriptedPrompter) Password(prompt string) ([]byte, error) {
+	answer, err := p.next(prompt)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(answer), nil
+}
+
+func (p *ScriptedPrompter) Text(prompt, icon string) (string, error) {
+	return p.next(prompt)
+}
+
+func (p *ScriptedPrompter) Confirm(prompt string) (bool, error) {
+	answer, err := p.next(prompt)
+	if err != nil {
+		return false, err
+	}
+	return isYes(answer), nil
+}
+
+// EditPassword keeps value when the scripted answer is empty
+func (p *ScriptedPrompter) EditPassword(prompt string, value []byte) ([]byte, error) {
+	answer, err := p.next(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if answer == "" {
+		return value, nil
+	}
+	return []byte(answer), nil
+}
+
+// EditText keeps value when the scripted answer is empty
+func (p *ScriptedPrompter) EditText(prompt, icon, value string) (string, error) {
+	answer, err := p.next(prompt)
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return value, nil
+	}
+	return answer, nil
+}
+
+func (p *ScriptedPrompter) next(prompt string) (string, error) {
+	p.Prompts = append(p.Prompts, prompt)
+	if len(p.Answers) == 0 {
+		return "", fmt.Errorf("%w for %q", ErrNoAnswer, prompt)
+	}
+	answer := p.Answers[0]
+	p.Answers = p.Answers[1:]
+	return answer, nil
+}
+
+func isYes(text string) bool {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
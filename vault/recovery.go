@@ -0,0 +1,334 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/armadi1809/vaulta/qrcode"
+	"github.com/armadi1809/vaulta/ui"
+)
+
+const (
+	// recoveryKeySize is the number of random bytes in a recovery key
+	recoveryKeySize = 16
+	// recoveryChecksumSize is the number of SHA-256 bytes appended to the
+	// recovery key words to catch typos
+	recoveryChecksumSize = 2
+)
+
+// ErrNoRecoveryKey is returned when unlocking with a recovery key a vault
+// that has none.
+var ErrNoRecoveryKey = errors.New("this vault has no recovery key")
+
+// GenerateRecoveryKey returns a new random recovery key.
+func GenerateRecoveryKey() ([]byte, error) {
+	return randomBytes(recoveryKeySize)
+}
+
+// RecoveryWords returns the words a recovery key is written down as: one
+// word per byte followed by checksum words.
+func RecoveryWords(recovery []byte) []string {
+	sum := sha256.Sum256(recovery)
+	data := append(bytes.Clone(recovery), sum[:recoveryChecksumSize]...)
+	defer zero(data)
+	return encodeWords(data)
+}
+
+// ParseRecoveryKey parses the words of a recovery key, separated by spaces or
+// dashes. Each word may be shortened to its first four letters, and line
+// numbers as printed in the emergency kit are ignored.
+func ParseRecoveryKey(text string) ([]byte, error) {
+	words := splitWords(text)
+	if n := recoveryKeySize + recoveryChecksumSize; len(words) != n {
+		return nil, fmt.Errorf("a recovery key has %d words, got %d", n, len(words))
+	}
+
+	data, err := decodeWords(words)
+	if err != nil {
+		return nil, err
+	}
+	recovery := data[:recoveryKeySize]
+	sum := sha256.Sum256(recovery)
+	if !bytes.Equal(data[recoveryKeySize:], sum[:recoveryChecksumSize]) {
+		zero(data)
+		return nil, errors.New("recovery key checksum mismatch, check the words for typos")
+	}
+	return recovery, nil
+}
+
+// HasRecoveryKey reports whether the vault has a recovery key slot.
+func (s *Session) HasRecoveryKey() bool {
+	return s.hasKeySlot(SlotRecovery)
+}
+
+// SetRecoveryKey replaces any recovery key slot with one unlocked by recovery
+// and returns its ID. Changes are written by the next Save.
+func (s *Session) SetRecoveryKey(recovery []byte, params KDFParams) (int, error) {
+	if s.key == nil {
+		return 0, ErrClosed
+	}
+	if s.unlockedSlot().Type == SlotRecovery {
+		return 0, errors.New("cannot replace the recovery key the vault was unlocked with, unlock it with your password first")
+	}
+	return s.replaceKeySlots(Key{Recovery: recovery}, params)
+}
+
+// SetPassphrase sets the master password, typically after unlocking with a
+// recovery key or escrow shares. The data key is re-wrapped in the first key
+// slot that needs a password, keeping its type and KDF parameters, or in a
+// new slot when there is none. A slot that also needs a keyfile is re-wrapped
+// with keyfile, and ErrKeyfileRequired is returned when it is nil, so that
+// the vault keeps requiring it. Changes are written by the next Save.
+func (s *Session) SetPassphrase(passphrase, keyfile []byte) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	i := s.file.passwordSlot()
+	if i < 0 {
+		_, err := s.AddKeySlot(Key{Password: passphrase, Keyfile: keyfile}, s.KDFParams())
+		return err
+	}
+
+	current := s.file.KeySlots[i]
+	key := Key{Password: passphrase}
+	if current.needsKeyfile() {
+		if keyfile == nil {
+			return ErrKeyfileRequired
+		}
+		key.Keyfile = keyfile
+	}
+	slot, err := newKeySlot(current.ID, key, s.key, current.KDF.params(), s.file.Cipher.Algorithm)
+	if err != nil {
+		return err
+	}
+	s.file.KeySlots[i] = slot
+	return nil
+}
+
+// passwordSlot returns the index of the first key slot that needs a
+// password, or -1 if there is none
+func (v *VaultFile) passwordSlot() int {
+	for i := range v.KeySlots {
+		if v.KeySlots[i].needsPassword() {
+			return i
+		}
+	}
+	return -1
+}
+
+// GenerateRecoveryKey adds a recovery key slot, replacing any previous one,
+// and returns the recovery key to show to the user. With kitPath, the
+// emergency kit is also written there as a plain text document.
+func (v *Vault) GenerateRecoveryKey(kitPath string) (string, error) {
+	v.logo()
+	v.title("🆘 Recovery Key")
+
+	session, err := v.unlock()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	if session.HasRecoveryKey() {
+		replace, err := v.prompter.Confirm("This vault already has a recovery key, which will stop working. Replace it?")
+		if err != nil {
+			return "", err
+		}
+		if !replace {
+			v.println(ui.RenderInfo("Info", "Recovery key unchanged."))
+			return "", nil
+		}
+	}
+
+	recovery, err := GenerateRecoveryKey()
+	if err != nil {
+		return "", err
+	}
+	defer zero(recovery)
+	words := RecoveryWords(recovery)
+	modules, err := qrcode.Encode(strings.Join(words, " "))
+	if err != nil {
+		return "", err
+	}
+
+	id, err := session.SetRecoveryKey(recovery, session.KDFParams())
+	if err != nil {
+		return "", err
+	}
+	if kitPath != "" {
+		if err := writeEmergencyKit(kitPath, session.Path(), words, modules); err != nil {
+			return "", fmt.Errorf("writing emergency kit: %w", err)
+		}
+	}
+	if err := session.Save(); err != nil {
+		if kitPath != "" {
+			os.Remove(kitPath)
+		}
+		return "", err
+	}
+
+	v.println(ui.RenderSuccess(fmt.Sprintf("Recovery key added in key slot %d.", id)))
+	if kitPath != "" {
+		v.println(ui.RenderSuccess(fmt.Sprintf("Emergency kit written to %s", kitPath)))
+	}
+	v.println(ui.RenderWarning("Write the recovery key down and keep it somewhere safe. It is shown only once, and anyone who has it can open your vault."))
+
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(recoveryOutput{Slot: id, Words: words})
+	case FormatYAML:
+		return marshalYAML(recoveryOutput{Slot: id, Words: words})
+	case FormatRaw:
+		return strings.Join(words, " "), nil
+	default:
+		return ui.RenderInfo("Recovery Key", strings.Join(numberedLines(words), "\n")+"\n\n"+ui.RenderQRCode(modules, true)), nil
+	}
+}
+
+// RecoveryUnlock unlocks the vault with a recovery key and sets a new master
+// password.
+func (v *Vault) RecoveryUnlock() error {
+	v.logo()
+	v.title("🆘 Recover Vault")
+
+	file, err := v.readHeader()
+	if err != nil {
+		return err
+	}
+	keyfile, err := v.resetKeyfile(file)
+	if err != nil {
+		return err
+	}
+	defer zero(keyfile)
+
+	text, err := v.prompter.Password("Enter your recovery key")
+	if err != nil {
+		return err
+	}
+	recovery, err := ParseRecoveryKey(string(text))
+	zero(text)
+	if err != nil {
+		return err
+	}
+
+	session, err := OpenKey(v.path, Key{Recovery: recovery})
+	zero(recovery)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	reset, err := v.resetPassword(session, keyfile)
+	if err != nil || !reset {
+		return err
+	}
+	v.println(ui.DimStyle.Render("  The recovery key still works. Run 'vaulta recovery generate' to replace it if it was exposed."))
+	v.println()
+	return nil
+}
+
+// readHeader reads the vault file to check what it can be unlocked with
+// before prompting for anything
+func (v *Vault) readHeader() (*VaultFile, error) {
+	file, _, err := readVaultFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoVault
+	}
+	return file, err
+}
+
+// resetKeyfile returns the keyfile the master password of file is combined
+// with, or nil when it has none. Resetting the password keeps needing it, so
+// it is read before a recovery key or escrow shares are typed in vain.
+func (v *Vault) resetKeyfile(file *VaultFile) ([]byte, error) {
+	if i := file.passwordSlot(); i < 0 || !file.KeySlots[i].needsKeyfile() {
+		return nil, nil
+	}
+	if v.keyfile == "" {
+		return nil, fmt.Errorf("%w: the master password of this vault is combined with a keyfile, pass it with --keyfile", ErrKeyfileRequired)
+	}
+	return ReadKeyfile(v.keyfile)
+}
+
+// resetPassword asks for a new master password for a session unlocked
+// without one and saves it, combined with keyfile as returned by
+// resetKeyfile. It reports false if the user gave up.
+func (v *Vault) resetPassword(session *Session, keyfile []byte) (bool, error) {
+	newPwd, err := v.chooseNewPassword("Choose a new master password")
+	if err != nil {
+		return false, err
+	}
+	if newPwd == nil {
+		v.println(ui.RenderInfo("Info", "Master password unchanged."))
+		return false, nil
+	}
+	defer zero(newPwd)
+
+	if err := session.SetPassphrase(newPwd, keyfile); err != nil {
+		return false, err
+	}
+	if err := session.Save(); err != nil {
+		return false, err
+	}
+
+	v.println(ui.RenderSuccess("Vault recovered, unlock it with your new master password from now on."))
+	return true, nil
+}
+
+// recoveryOutput is the machine readable form of a new recovery key
+type recoveryOutput struct {
+	Slot  int      `json:"slot"`
+	Words []string `json:"words"`
+}
+
+// writeEmergencyKit writes a plain text document holding the recovery key
+// and instructions to use it, refusing to overwrite an existing file
+func writeEmergencyKit(path, vaultPath string, words []string, modules [][]bool) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, "VAULTA EMERGENCY KIT")
+	fmt.Fprintln(&b, "====================")
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Vault:    %s\n", vaultPath)
+	fmt.Fprintf(&b, "Created:  %s\n", now().Format("2006-01-02 15:04 MST"))
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "Recovery key")
+	fmt.Fprintln(&b, "------------")
+	fmt.Fprintln(&b)
+	for _, line := range numberedLines(words) {
+		fmt.Fprintf(&b, "    %s\n", line)
+	}
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, ui.RenderQRCode(modules, false))
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "How to use it")
+	fmt.Fprintln(&b, "-------------")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "If you forget your master password, run")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "    vaulta recovery unlock")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "and type the words above in order, or scan the code. Only the first")
+	fmt.Fprintln(&b, "four letters of each word are needed. You then choose a new master")
+	fmt.Fprintln(&b, "password.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "Keep this document somewhere safe, such as a locked drawer. Anyone who")
+	fmt.Fprintln(&b, "has it can open your vault.")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
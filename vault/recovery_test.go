@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetPassphraseKeepsKeyfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	keyfile := bytes.Repeat([]byte{7}, 32)
+	session, err := CreateKey(path, Key{Password: []byte("old password"), Keyfile: keyfile}, WithKDFParams(testKDFParams))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.SetRecoveryKey(recovery, testKDFParams); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	session, err = OpenKey(path, Key{Recovery: recovery})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SetPassphrase([]byte("new password"), nil); !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("SetPassphrase without the keyfile returned %v, want %v", err, ErrKeyfileRequired)
+	}
+	if err := session.SetPassphrase([]byte("new password"), keyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	var types []string
+	file, _, err := readVaultFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slot := range file.KeySlots {
+		types = append(types, slot.Type)
+	}
+	if len(types) != 2 || types[0] != SlotPasswordKeyfile || types[1] != SlotRecovery {
+		t.Errorf("key slots are %v, want [%s %s]", types, SlotPasswordKeyfile, SlotRecovery)
+	}
+
+	if _, err := Open(path, []byte("new password")); !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("Open with the new password alone returned %v, want %v", err, ErrKeyfileRequired)
+	}
+	if _, err := OpenKey(path, Key{Password: []byte("old password"), Keyfile: keyfile}); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("OpenKey with the old password returned %v, want %v", err, ErrInvalidPassword)
+	}
+	session, err = OpenKey(path, Key{Password: []byte("new password"), Keyfile: keyfile})
+	if err != nil {
+		t.Fatalf("OpenKey with the new password and keyfile: %v", err)
+	}
+	session.Close()
+}
+
+func TestSetPassphraseAddsPasswordSlot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	keyfile := bytes.Repeat([]byte{7}, 32)
+	session, err := CreateKey(path, Key{Keyfile: keyfile}, WithKDFParams(testKDFParams))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.SetPassphrase([]byte("password"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if i := session.file.passwordSlot(); i < 0 || session.file.KeySlots[i].Type != SlotPassword {
+		t.Errorf("no password slot was added to a keyfile-only vault")
+	}
+}
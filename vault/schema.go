@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// currentSchema is the version of the JSON payload stored inside the
+// ciphertext. Payloads written before the field existed are schema 1.
+const currentSchema = 3
+
+// schemaMigrations upgrade a decoded payload from the schema version used as
+// key to the next one
+var schemaMigrations = map[int]func(payload map[string]any) error{
+	1: migrateSchema1,
+	2: migrateSchema2,
+}
+
+// decodeVaultData decodes a decrypted payload, upgrading older schemas to the
+// current one. The upgraded payload is written on the next Save.
+func decodeVaultData(plaintext []byte) (VaultData, error) {
+	var probe struct {
+		Schema int `json:"schema"`
+	}
+	if err := json.Unmarshal(plaintext, &probe); err != nil {
+		return VaultData{}, err
+	}
+	schema := max(probe.Schema, 1)
+	if schema > currentSchema {
+		return VaultData{}, fmt.Errorf("vault data uses schema %d, this version of vaulta only supports up to %d, please upgrade vaulta", schema, currentSchema)
+	}
+
+	if schema < currentSchema {
+		dec := json.NewDecoder(bytes.NewReader(plaintext))
+		dec.UseNumber()
+		var payload map[string]any
+		if err := dec.Decode(&payload); err != nil {
+			return VaultData{}, err
+		}
+		for ; schema < currentSchema; schema++ {
+			if err := schemaMigrations[schema](payload); err != nil {
+				return VaultData{}, fmt.Errorf("migrating vault data from schema %d: %w", schema, err)
+			}
+		}
+		migrated, err := json.Marshal(payload)
+		if err != nil {
+			return VaultData{}, err
+		}
+		defer zero(migrated)
+		plaintext = migrated
+	}
+
+	var data VaultData
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return VaultData{}, err
+	}
+	data.Schema = currentSchema
+	if data.Entries == nil {
+		data.Entries = make(map[string]Entry)
+	}
+	return data, nil
+}
+
+// migrateSchema1 turns the single "url" of each entry, and of each of its
+// previous versions, into the "urls" list
+func migrateSchema1(payload map[string]any) error {
+	entries, _ := payload["entries"].(map[string]any)
+	for _, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			return fmt.Errorf("unexpected entry of type %T", e)
+		}
+		migrateURL(entry)
+
+		history, _ := entry["history"].([]any)
+		for _, v := range history {
+			if version, ok := v.(map[string]any); ok {
+				migrateURL(version)
+			}
+		}
+	}
+	return nil
+}
+
+func migrateURL(entry map[string]any) {
+	if u, ok := entry["url"].(string); ok && u != "" {
+		entry["urls"] = []any{u}
+	}
+	delete(entry, "url")
+}
+
+// migrateSchema2 changes nothing. Schema 3 adds TOTP secrets to entries, and
+// only exists so that older versions of vaulta refuse the vault instead of
+// silently dropping them when saving it.
+func migrateSchema2(payload map[string]any) error {
+	return nil
+}
@@ -0,0 +1,240 @@
+package vault
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sort orders accepted by ListOptions.
+const (
+	SortName     = "name"
+	SortCreated  = "created"
+	SortModified = "modified"
+	SortAccessed = "accessed"
+)
+
+// maxSuggestions is the number of entry names offered when one is not found
+const maxSuggestions = 3
+
+// ListOptions selects and orders the entries returned by ListEntries.
+type ListOptions struct {
+	// Tags keeps only the entries carrying all of these tags.
+	Tags []string
+	// Sort is one of SortName, the default, SortCreated, SortModified and
+	// SortAccessed. Timestamps sort the most recent first.
+	Sort string
+}
+
+// Search returns the names of the entries matching query, best matches
+// first. Every word of the query must match the name, username, URLs, tags
+// or notes of an entry, exactly or as letters in order, so "gh" matches
+// "github".
+func (s *Session) Search(query string) ([]string, error) {
+	if s.key == nil {
+		return nil, ErrClosed
+	}
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return s.List()
+	}
+
+	scores := map[string]int{}
+	for name, entry := range s.data.Entries {
+		if score := entryScore(name, entry, terms); score > 0 {
+			scores[name] = score
+		}
+	}
+	names := make([]string, 0, len(scores))
+	for name := range scores {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(scores[b], scores[a]), cmp.Compare(a, b))
+	})
+	return names, nil
+}
+
+// searchField is a field of an entry matched by Search, with the score
+// penalty of matches in it
+type searchField struct {
+	text    string
+	penalty int
+}
+
+// entryScore sums how well each term matches the best field of an entry, or
+// returns 0 if a term matches none. Matches in the name weigh the most.
+func entryScore(name string, entry Entry, terms []string) int {
+	fields := []searchField{{name, 0}, {entry.Username, 10}}
+	for _, u := range entry.URLs {
+		fields = append(fields, searchField{u, 10})
+	}
+	for _, tag := range entry.Tags {
+		fields = append(fields, searchField{tag, 10})
+	}
+	fields = append(fields, searchField{entry.Notes, 20})
+
+	total := 0
+	for _, term := range terms {
+		best := 0
+		for _, field := range fields {
+			if score := fuzzyScore(term, field.text); score > 0 {
+				best = max(best, score-field.penalty, 1)
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total
+}
+
+// fuzzyScore rates how well query, in lower case, matches text, from 100 for
+// an exact match down to 0 for no match. Besides substrings, it accepts the
+// letters of the query in order, rewarding consecutive ones.
+func fuzzyScore(query, text string) int {
+	text = strings.ToLower(text)
+	switch {
+	case query == "" || text == "":
+		return 0
+	case text == query:
+		return 100
+	case strings.HasPrefix(text, query):
+		return 80
+	case strings.Contains(text, query):
+		return 60
+	}
+
+	q := []rune(query)
+	i, run, bonus := 0, 0, 0
+	for _, r := range text {
+		if i < len(q) && r == q[i] {
+			i++
+			run++
+			bonus += run
+		} else {
+			run = 0
+		}
+	}
+	if i < len(q) {
+		return 0
+	}
+	// bonus reaches len(q)*(len(q)+1)/2 when all the letters are consecutive
+	return 20 + 20*bonus/(len(q)*(len(q)+1)/2)
+}
+
+// suggestions returns the entry names closest to name, for a "did you mean"
+// hint: those within a few typos, then fuzzy matches
+func (s *Session) suggestions(name string) []string {
+	name = normalizeName(name)
+	distances := map[string]int{}
+	for candidate := range s.data.Entries {
+		limit := max(1, len([]rune(candidate))/3)
+		if d := levenshtein(name, candidate); d <= limit {
+			distances[candidate] = d
+		}
+	}
+	names := make([]string, 0, len(distances))
+	for candidate := range distances {
+		names = append(names, candidate)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(distances[a], distances[b]), cmp.Compare(a, b))
+	})
+
+	if matches, err := s.Search(name); err == nil {
+		for _, match := range matches {
+			if !slices.Contains(names, match) {
+				names = append(names, match)
+			}
+		}
+	}
+	return names[:min(len(names), maxSuggestions)]
+}
+
+// levenshtein returns the number of single letter insertions, deletions and
+// substitutions turning a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// entryNotFound returns the error for a missing entry, suggesting the
+// closest names
+func entryNotFound(s *Session, name string) error {
+	suggestions := s.suggestions(name)
+	if len(suggestions) == 0 {
+		return fmt.Errorf("entry '%s' not found in vault, run 'vaulta list' to see all entries", name)
+	}
+	quoted := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		quoted[i] = "'" + suggestion + "'"
+	}
+	hint := quoted[0]
+	if len(quoted) > 1 {
+		hint = strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+	}
+	return fmt.Errorf("entry '%s' not found in vault, did you mean %s?", name, hint)
+}
+
+// selectEntries returns the names of the entries matching opts, in the order
+// it asks for
+func selectEntries(entries map[string]Entry, opts ListOptions) ([]string, error) {
+	var timestamp func(Entry) time.Time
+	switch opts.Sort {
+	case "", SortName:
+	case SortCreated:
+		timestamp = func(e Entry) time.Time { return e.Created }
+	case SortModified:
+		timestamp = func(e Entry) time.Time { return e.Modified }
+	case SortAccessed:
+		timestamp = func(e Entry) time.Time { return e.Accessed }
+	default:
+		return nil, fmt.Errorf("unknown sort order %q, expected one of name, created, modified, accessed", opts.Sort)
+	}
+
+	var names []string
+	for name, entry := range entries {
+		if hasTags(entry, opts.Tags) {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if timestamp != nil {
+			if c := timestamp(entries[b]).Compare(timestamp(entries[a])); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a, b)
+	})
+	return names, nil
+}
+
+// hasTags reports whether entry carries all of tags, ignoring case
+func hasTags(entry Entry, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.ContainsFunc(entry.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return false
+		}
+	}
+	return true
+}
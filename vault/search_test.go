@@ -0,0 +1,192 @@
+package vault
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSession creates a vault holding entries and returns it unlocked
+func newTestSession(t *testing.T, entries map[string]Entry) *Session {
+	t.Helper()
+	session, err := Create(filepath.Join(t.TempDir(), "vault.json"), []byte("correct horse"), WithKDFParams(testKDFParams))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	for name, entry := range entries {
+		if err := session.Put(name, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return session
+}
+
+func TestFuzzyScore(t *testing.T) {
+	// From the best match of "github" to none
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"github", 100},
+		{"git", 80},
+		{"hub", 60},
+		{"gthu", 34},
+		{"gthb", 30},
+		{"gh", 33},
+		{"hg", 0},
+		{"gitlab", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := fuzzyScore(test.query, "GitHub"); got != test.want {
+			t.Errorf("fuzzyScore(%q, GitHub) = %d, want %d", test.query, got, test.want)
+		}
+	}
+	if got := fuzzyScore("a", ""); got != 0 {
+		t.Errorf("fuzzyScore of an empty text = %d, want 0", got)
+	}
+}
+
+func TestSearchOrder(t *testing.T) {
+	session := newTestSession(t, map[string]Entry{
+		"github":      {},
+		"github-work": {},
+		"my-github":   {},
+		"ci":          {Username: "github-bot"},
+		"gh-pages":    {Notes: "mirror of the github docs"},
+		"bank":        {Tags: []string{"finance"}},
+	})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// exact, prefix, username prefix, substring, fuzzy name, notes
+		{"github", []string{"github", "github-work", "ci", "my-github", "gh-pages"}},
+		{"GitHub Work", []string{"github-work"}},
+		{"fin", []string{"bank"}},
+		{"nothing", []string{}},
+	}
+	for _, test := range tests {
+		got, err := session.Search(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Search(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	all, err := session.Search("  ")
+	if err != nil || len(all) != 6 {
+		t.Errorf("an empty search returned %q, %v, want every entry", all, err)
+	}
+}
+
+func TestSelectEntries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	entries := map[string]Entry{
+		"bank":   {Tags: []string{"Finance", "personal"}, Created: day(1), Modified: day(5), Accessed: day(2)},
+		"github": {Tags: []string{"work", "code"}, Created: day(3), Modified: day(3), Accessed: day(9)},
+		"gitlab": {Tags: []string{"work"}, Created: day(3), Modified: day(4)},
+		"mail":   {Created: day(2), Modified: day(2), Accessed: day(1)},
+	}
+	tests := []struct {
+		opts ListOptions
+		want []string
+	}{
+		{ListOptions{}, []string{"bank", "github", "gitlab", "mail"}},
+		{ListOptions{Tags: []string{"work"}}, []string{"github", "gitlab"}},
+		{ListOptions{Tags: []string{"WORK", "code"}}, []string{"github"}},
+		{ListOptions{Tags: []string{"finance"}}, []string{"bank"}},
+		{ListOptions{Tags: []string{"work", "finance"}}, nil},
+		{ListOptions{Tags: []string{"wor"}}, nil},
+		// Most recent first, ties by name
+		{ListOptions{Sort: SortCreated}, []string{"github", "gitlab", "mail", "bank"}},
+		{ListOptions{Sort: SortModified}, []string{"bank", "gitlab", "github", "mail"}},
+		{ListOptions{Sort: SortAccessed, Tags: []string{"work"}}, []string{"github", "gitlab"}},
+	}
+	for _, test := range tests {
+		got, err := selectEntries(entries, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("selectEntries(%+v) = %q, want %q", test.opts, got, test.want)
+		}
+	}
+
+	if _, err := selectEntries(entries, ListOptions{Sort: "size"}); err == nil {
+		t.Error("selectEntries accepted an unknown sort order")
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"github", "github", 0},
+		{"githb", "github", 1},
+		{"gihtub", "github", 2},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"café", "cafe", 1},
+	}
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := levenshtein(test.b, test.a); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	session := newTestSession(t, map[string]Entry{
+		"github":    {},
+		"gitlab":    {},
+		"gitea":     {},
+		"bitbucket": {},
+		"mail":      {},
+		"ab":        {},
+	})
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"githb", []string{"github", "gitlab"}},
+		{"GitLub", []string{"github", "gitlab"}},
+		// Typos come first, then fuzzy matches, at most maxSuggestions
+		{"git", []string{"gitea", "github", "gitlab"}},
+		{"mall", []string{"mail"}},
+		// A third of the letters may differ, and at least one
+		{"bitbukkit", []string{"bitbucket"}},
+		{"bitbakkat", []string{"bitbucket"}},
+		{"bitbakkaa", nil},
+		{"xb", []string{"ab"}},
+		{"xy", nil},
+		{"zzzzzz", nil},
+	}
+	for _, test := range tests {
+		if got := session.suggestions(test.name); !slices.Equal(got, test.want) {
+			t.Errorf("suggestions(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	err := entryNotFound(session, "githb")
+	if want := "did you mean 'github' or 'gitlab'?"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("entryNotFound returned %v, want it to contain %q", err, want)
+	}
+	err = entryNotFound(session, "zzzzzz")
+	if want := "run 'vaulta list'"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("entryNotFound returned %v, want it to contain %q", err, want)
+	}
+}
@@ -0,0 +1,452 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoVault is returned when there is no vault file at the given path.
+	ErrNoVault = errors.New("no vault found, initialize one by running the init command")
+	// ErrInvalidPassword is returned when the vault cannot be decrypted.
+	ErrInvalidPassword = errors.New("invalid password or corrupted vault")
+	// ErrEntryNotFound is returned when an entry does not exist in the vault.
+	ErrEntryNotFound = errors.New("entry not found")
+	// ErrEntryExists is returned when an entry would be silently replaced.
+	ErrEntryExists = errors.New("entry already exists")
+	// ErrEmptyName is returned when an entry name is blank.
+	ErrEmptyName = errors.New("entry name cannot be empty")
+	// ErrClosed is returned when a closed session is used.
+	ErrClosed = errors.New("vault session is closed")
+)
+
+// Session is an unlocked vault. It keeps the data encryption key and the
+// decrypted entries in memory until Close is called, and never prompts or
+// prints.
+type Session struct {
+	path string
+	file *VaultFile
+	key  []byte
+	// slot is the index of the key slot that unlocked the session
+	slot int
+	// keyfile is the keyfile digest the session was unlocked with, if any
+	keyfile []byte
+	data    VaultData
+	// lock keeps other processes from opening the vault until Close, nil
+	// where locking is not supported or after releaseLock
+	lock *fileLock
+	// hash is the SHA-256 of the vault file as last read or written, nil
+	// for a new vault
+	hash []byte
+}
+
+// Open unlocks the vault at path with the given passphrase. The passphrase is
+// not retained; the caller remains responsible for zeroing it.
+//
+// The vault is locked against other vaulta processes until the session is
+// closed. If another process holds the lock, Open waits for a few seconds and
+// then returns a *LockedError.
+//
+// Vaults written in an older file format are upgraded: once the passphrase is
+// verified, a copy of the original file is kept next to it and the upgraded
+// vault is written in its place.
+func Open(path string, passphrase []byte) (*Session, error) {
+	return OpenKey(path, Key{Password: passphrase})
+}
+
+// OpenKey unlocks the vault at path with the password and keyfile of key.
+// ErrKeyfileRequired and ErrPasswordRequired report a missing factor, and
+// ErrNoRecoveryKey a recovery key for a vault without one.
+func OpenKey(path string, key Key) (session *Session, err error) {
+	if !checkFileExists(path) {
+		return nil, ErrNoVault
+	}
+	lock, err := lockVault(path, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if session == nil {
+			lock.release()
+		}
+	}()
+
+	file, hash, err := readVaultFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoVault
+		}
+		return nil, err
+	}
+	if err := file.checkVersion(); err != nil {
+		return nil, err
+	}
+	if err := file.checkKDFParams(); err != nil {
+		return nil, err
+	}
+	if err := file.checkFactors(key.factors()); err != nil {
+		return nil, err
+	}
+	fromVersion := file.Version
+	if err := file.migrate(key.Password); err != nil {
+		return nil, err
+	}
+	if err := file.checkAlgorithms(); err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext, err := file.decodeCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, slot, err := file.unlockSlot(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decrypt(file.Cipher.Algorithm, dataKey, nonce, ciphertext, file.additionalData())
+	if err != nil {
+		zero(dataKey)
+		return nil, err
+	}
+	defer zero(plaintext)
+
+	data, err := decodeVaultData(plaintext)
+	if err != nil {
+		zero(dataKey)
+		return nil, err
+	}
+
+	session = &Session{path: path, file: file, key: dataKey, slot: slot, data: data, lock: lock, hash: hash}
+	if key.Keyfile != nil {
+		session.keyfile = bytes.Clone(key.Keyfile)
+	}
+	if fromVersion != currentVersion {
+		if err := backupVaultFile(path, fromVersion); err != nil {
+			session.Close()
+			return nil, fmt.Errorf("backing up vault before migration: %w", err)
+		}
+		if err := session.Save(); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// CreateOption configures a vault created by Create.
+type CreateOption func(*createOptions)
+
+type createOptions struct {
+	kdf    KDFParams
+	cipher string
+}
+
+// WithKDFParams sets the Argon2id parameters of a new vault.
+func WithKDFParams(params KDFParams) CreateOption {
+	return func(o *createOptions) {
+		o.kdf = params
+	}
+}
+
+// WithCipher sets the cipher algorithm of a new vault, one of Ciphers.
+func WithCipher(algorithm string) CreateOption {
+	return func(o *createOptions) {
+		o.cipher = algorithm
+	}
+}
+
+// Create writes a new empty vault at path, replacing any existing file, and
+// returns it unlocked. The payload is encrypted with a random data key held in
+// a key slot unlocked by passphrase.
+func Create(path string, passphrase []byte, opts ...CreateOption) (*Session, error) {
+	return CreateKey(path, Key{Password: passphrase}, opts...)
+}
+
+// CreateKey is like Create, with a first key slot unlocked by the password,
+// the keyfile or both, as set in key.
+func CreateKey(path string, key Key, opts ...CreateOption) (*Session, error) {
+	o := createOptions{kdf: DefaultKDFParams(), cipher: CipherAES256GCM}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.kdf.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkCipher(o.cipher); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockVault(path, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := randomBytes(dataKeySize)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+
+	s := &Session{
+		path: path,
+		file: newVaultFile(o.cipher),
+		key:  dataKey,
+		data: VaultData{Schema: currentSchema, Entries: make(map[string]Entry)},
+		lock: lock,
+	}
+	if _, err := s.AddKeySlot(key, o.kdf); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if key.Keyfile != nil {
+		s.keyfile = bytes.Clone(key.Keyfile)
+	}
+	if err := s.Save(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the location of the vault file.
+func (s *Session) Path() string {
+	return s.path
+}
+
+// Get returns the entry stored under name.
+func (s *Session) Get(name string) (Entry, error) {
+	if s.key == nil {
+		return Entry{}, ErrClosed
+	}
+	entry, ok := s.data.Entries[normalizeName(name)]
+	if !ok {
+		return Entry{}, fmt.Errorf("%w: '%s'", ErrEntryNotFound, name)
+	}
+	return entry, nil
+}
+
+// Put stores entry under name. An existing entry is replaced and kept as its
+// most recent previous version, subject to the retention policy. Changes are
+// kept in memory until Save is called.
+func (s *Session) Put(name string, entry Entry) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	key := normalizeName(name)
+	if key == "" {
+		return ErrEmptyName
+	}
+	entry.History = nil
+	if old, ok := s.data.Entries[key]; ok {
+		entry.stamp(&old, now())
+		entry = withHistory(entry, old, s.Retention())
+	} else {
+		entry.stamp(nil, now())
+	}
+	s.data.Entries[key] = entry
+	return nil
+}
+
+// Touch records that the entry stored under name was accessed. Changes are
+// kept in memory until Save is called.
+func (s *Session) Touch(name string) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	key := normalizeName(name)
+	entry, ok := s.data.Entries[key]
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrEntryNotFound, name)
+	}
+	entry.Accessed = now()
+	s.data.Entries[key] = entry
+	return nil
+}
+
+// Delete removes the entry stored under name. Changes are kept in memory until
+// Save is called.
+func (s *Session) Delete(name string) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	key := normalizeName(name)
+	if _, ok := s.data.Entries[key]; !ok {
+		return fmt.Errorf("%w: '%s'", ErrEntryNotFound, name)
+	}
+	delete(s.data.Entries, key)
+	return nil
+}
+
+// List returns the names of all entries in sorted order.
+func (s *Session) List() ([]string, error) {
+	if s.key == nil {
+		return nil, ErrClosed
+	}
+	names := make([]string, 0, len(s.data.Entries))
+	for name := range s.data.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Save encrypts the entries with the session key and writes them to disk.
+func (s *Session) Save() error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	if err := s.seal(); err != nil {
+		return err
+	}
+	return s.write(true)
+}
+
+// saveAccess writes the access times recorded with Touch. Unlike Save, it
+// does not replace the backup of the vault file, which keeps the version
+// before the last actual change.
+func (s *Session) saveAccess() error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	if err := s.seal(); err != nil {
+		return err
+	}
+	return s.write(false)
+}
+
+// write replaces the vault file with s.file, unless another process changed
+// it since the session read or last wrote it. With backup, the previous file
+// is kept, see writeFileAtomic.
+func (s *Session) write(backup bool) error {
+	if s.hash != nil {
+		_, current, err := readVaultFile(s.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if !bytes.Equal(current, s.hash) {
+			return ErrVaultChanged
+		}
+	}
+	hash, err := writeVaultFile(s.path, s.file, backup)
+	if err != nil {
+		return err
+	}
+	s.hash = hash
+	return nil
+}
+
+// releaseLock lets other processes open the vault while the session stays
+// unlocked. Call relock before writing again.
+func (s *Session) releaseLock() error {
+	err := s.lock.release()
+	s.lock = nil
+	return err
+}
+
+// relock takes the lock released by releaseLock again, waiting for up to
+// timeout, and reloads the vault if another process changed it meanwhile.
+func (s *Session) relock(timeout time.Duration) error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	lock, err := lockVault(s.path, timeout)
+	if err != nil {
+		return err
+	}
+	if err := s.reload(); err != nil {
+		lock.release()
+		return err
+	}
+	s.lock = lock
+	return nil
+}
+
+// reload reads the vault file again if it changed since the session read or
+// last wrote it, decrypting it with the session key. It returns
+// ErrVaultChanged if the data key or the key slot the session was unlocked
+// with are gone.
+func (s *Session) reload() error {
+	file, hash, err := readVaultFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoVault
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(hash, s.hash) {
+		return nil
+	}
+	if err := file.checkVersion(); err != nil {
+		return err
+	}
+	if err := file.checkAlgorithms(); err != nil {
+		return err
+	}
+	id := s.unlockedSlot().ID
+	slot := slices.IndexFunc(file.KeySlots, func(k KeySlot) bool { return k.ID == id })
+	if file.Version != currentVersion || slot < 0 {
+		return ErrVaultChanged
+	}
+
+	nonce, ciphertext, err := file.decodeCipher()
+	if err != nil {
+		return err
+	}
+	plaintext, err := decrypt(file.Cipher.Algorithm, s.key, nonce, ciphertext, file.additionalData())
+	if err != nil {
+		return ErrVaultChanged
+	}
+	defer zero(plaintext)
+	data, err := decodeVaultData(plaintext)
+	if err != nil {
+		return err
+	}
+	s.file, s.slot, s.data, s.hash = file, slot, data, hash
+	return nil
+}
+
+// seal encrypts the entries with the session key into the vault file
+func (s *Session) seal() error {
+	s.pruneHistory()
+	plaintext, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	defer zero(plaintext)
+
+	nonce, ciphertext, err := encrypt(s.file.Cipher.Algorithm, s.key, plaintext, s.file.additionalData())
+	if err != nil {
+		return err
+	}
+
+	s.file.updateCipher(nonce, ciphertext)
+	return nil
+}
+
+// Close zeroes the derived key, drops the decrypted entries and releases the
+// lock on the vault. Unsaved changes are discarded.
+func (s *Session) Close() error {
+	if s.key == nil {
+		return ErrClosed
+	}
+	zero(s.key)
+	zero(s.keyfile)
+	s.key = nil
+	s.keyfile = nil
+	s.data = VaultData{}
+	err := s.lock.release()
+	s.lock = nil
+	return err
+}
+
+// normalizeName returns the map key used to store an entry.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"errors"
+)
+
+// Shamir's secret sharing over GF(256), one byte of the secret at a time,
+// with the AES polynomial x^8 + x^4 + x^3 + x + 1. Each byte is the constant
+// term of a random polynomial of degree threshold-1, and a share holds the
+// evaluation of every polynomial at the share's nonzero x coordinate.
+
+// gfAdd adds two elements of GF(256), which is also subtraction
+func gfAdd(a, b byte) byte {
+	return a ^ b
+}
+
+// gfMul multiplies two elements of GF(256). It takes the same time whatever
+// the operands, so shares do not leak through timing.
+func gfMul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= -(b & 1) & a
+		carry := -(a >> 7)
+		a = a<<1 ^ 0x1B&carry
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a nonzero element, a^254
+func gfInv(a byte) byte {
+	result := byte(1)
+	for range 254 {
+		result = gfMul(result, a)
+	}
+	return result
+}
+
+// gfDiv divides a by the nonzero element b
+func gfDiv(a, b byte) byte {
+	return gfMul(a, gfInv(b))
+}
+
+// share is one point of every polynomial
+type share struct {
+	x byte
+	y []byte
+}
+
+// splitSecret splits secret into n shares, any threshold of which recover it
+func splitSecret(secret []byte, n, threshold int) ([]share, error) {
+	if err := validateSplit(n, threshold); err != nil {
+		return nil, err
+	}
+
+	shares := make([]share, n)
+	for i := range shares {
+		shares[i] = share{x: byte(i + 1), y: make([]byte, len(secret))}
+	}
+
+	coefficients := make([]byte, threshold)
+	defer zero(coefficients)
+	for i, b := range secret {
+		random, err := randomBytes(threshold - 1)
+		if err != nil {
+			return nil, err
+		}
+		coefficients[0] = b
+		copy(coefficients[1:], random)
+		zero(random)
+		for _, s := range shares {
+			s.y[i] = evaluate(coefficients, s.x)
+		}
+	}
+	return shares, nil
+}
+
+// evaluate returns the value at x of the polynomial with the given
+// coefficients, lowest degree first
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = gfAdd(gfMul(y, x), coefficients[i])
+	}
+	return y
+}
+
+// combineShares recovers the secret from shares by Lagrange interpolation at
+// zero. With fewer shares than the threshold the result is meaningless.
+func combineShares(shares []share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are needed")
+	}
+	size := len(shares[0].y)
+	seen := make(map[byte]bool)
+	for _, s := range shares {
+		if s.x == 0 || seen[s.x] {
+			return nil, errors.New("shares must have distinct, nonzero x coordinates")
+		}
+		if len(s.y) != size {
+			return nil, errors.New("shares have different lengths")
+		}
+		seen[s.x] = true
+	}
+
+	secret := make([]byte, size)
+	for i, s := range shares {
+		// Lagrange basis polynomial of share i evaluated at zero
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other.x, gfAdd(other.x, s.x)))
+			}
+		}
+		for k := range secret {
+			secret[k] = gfAdd(secret[k], gfMul(s.y[k], basis))
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+// gfTables returns the exponential and logarithm tables of GF(256) with the
+// AES polynomial, built from the generator 3 without using gfMul
+func gfTables() (exp [255]byte, log [256]byte) {
+	x := byte(1)
+	for i := range exp {
+		exp[i] = x
+		log[x] = byte(i)
+		// x * 3 = x * 2 + x, reducing x * 2 by the polynomial
+		double := x << 1
+		if x&0x80 != 0 {
+			double ^= 0x1B
+		}
+		x = double ^ x
+	}
+	return exp, log
+}
+
+func TestGFTables(t *testing.T) {
+	exp, _ := gfTables()
+	seen := make(map[byte]bool)
+	for _, x := range exp {
+		seen[x] = true
+	}
+	if len(seen) != 255 || seen[0] {
+		t.Fatalf("3 generates %d nonzero elements, want 255", len(seen))
+	}
+}
+
+func TestGFMul(t *testing.T) {
+	exp, log := gfTables()
+	for a := range 256 {
+		for b := range 256 {
+			var want byte
+			if a != 0 && b != 0 {
+				want = exp[(int(log[a])+int(log[b]))%255]
+			}
+			if got := gfMul(byte(a), byte(b)); got != want {
+				t.Fatalf("gfMul(%#02x, %#02x) = %#02x, want %#02x", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestGFMulKnownValues(t *testing.T) {
+	// Examples from FIPS 197, section 4.2
+	tests := []struct{ a, b, want byte }{
+		{0x57, 0x83, 0xC1},
+		{0x57, 0x13, 0xFE},
+		{0x57, 0x02, 0xAE},
+		{0x57, 0x04, 0x47},
+		{0x57, 0x08, 0x8E},
+		{0x57, 0x10, 0x07},
+	}
+	for _, test := range tests {
+		if got := gfMul(test.a, test.b); got != test.want {
+			t.Errorf("gfMul(%#02x, %#02x) = %#02x, want %#02x", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestGFInv(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		inv := gfInv(byte(a))
+		if got := gfMul(byte(a), inv); got != 1 {
+			t.Errorf("gfMul(%#02x, gfInv(%#02x)) = %#02x, want 1", a, a, got)
+		}
+		if got := gfDiv(byte(a), byte(a)); got != 1 {
+			t.Errorf("gfDiv(%#02x, %#02x) = %#02x, want 1", a, a, got)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	coefficients := []byte{0x2A, 0x57, 0x83}
+	for x := range 256 {
+		want := coefficients[0] ^ gfMul(coefficients[1], byte(x)) ^ gfMul(coefficients[2], gfMul(byte(x), byte(x)))
+		if got := evaluate(coefficients, byte(x)); got != want {
+			t.Errorf("evaluate at %#02x = %#02x, want %#02x", x, got, want)
+		}
+	}
+	if got := evaluate(coefficients, 0); got != coefficients[0] {
+		t.Errorf("evaluate at 0 = %#02x, want the constant term %#02x", got, coefficients[0])
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	for _, split := range []struct{ n, threshold int }{{2, 2}, {3, 2}, {3, 3}, {5, 3}, {6, 4}, {7, 7}} {
+		t.Run(fmt.Sprintf("%d of %d", split.threshold, split.n), func(t *testing.T) {
+			shares, err := splitSecret(secret, split.n, split.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every subset of threshold shares or more recovers the secret,
+			// smaller ones do not
+			for mask := uint(1); mask < 1<<split.n; mask++ {
+				var subset []share
+				for i, s := range shares {
+					if mask&(1<<i) != 0 {
+						subset = append(subset, s)
+					}
+				}
+				if len(subset) < 2 {
+					continue
+				}
+				got, err := combineShares(subset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				enough := bits.OnesCount(mask) >= split.threshold
+				if enough != bytes.Equal(got, secret) {
+					t.Errorf("combining %d of %d shares (mask %b) recovered %q", len(subset), split.n, mask, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCombineSharesErrors(t *testing.T) {
+	shares, err := splitSecret([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]share{
+		"single share":      shares[:1],
+		"duplicate x":       {shares[0], shares[0]},
+		"zero x":            {{x: 0, y: shares[0].y}, shares[1]},
+		"different lengths": {shares[0], {x: 2, y: []byte("short")}},
+	}
+	for name, shares := range tests {
+		if _, err := combineShares(shares); err == nil {
+			t.Errorf("%s: combineShares succeeded", name)
+		}
+	}
+}
+
+func TestSplitSecretLimits(t *testing.T) {
+	for _, split := range []struct{ n, threshold int }{{1, 1}, {3, 1}, {2, 3}, {256, 2}} {
+		if _, err := splitSecret([]byte("secret"), split.n, split.threshold); err == nil {
+			t.Errorf("splitting into %d shares with threshold %d succeeded", split.n, split.threshold)
+		}
+	}
+}
+
+func TestEscrowShareWords(t *testing.T) {
+	escrow := bytes.Repeat([]byte{0xA5}, escrowKeySize)
+	shares, err := SplitEscrowKey(escrow, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := make([]EscrowShare, len(shares))
+	for i, s := range shares {
+		parsed[i], err = ParseEscrowShare(strings.Join(s.Words(), " "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed[i].Set != s.Set || parsed[i].Threshold != s.Threshold || parsed[i].X != s.X || !bytes.Equal(parsed[i].Y, s.Y) {
+			t.Errorf("share %d parsed as %+v, want %+v", i, parsed[i], s)
+		}
+	}
+	got, err := CombineEscrowShares(parsed[1:])
+	if err != nil || !bytes.Equal(got, escrow) {
+		t.Errorf("CombineEscrowShares returned %x, %v, want %x", got, err, escrow)
+	}
+}
+
+func TestParseEscrowShareChecksum(t *testing.T) {
+	shares, err := SplitEscrowKey(bytes.Repeat([]byte{1}, escrowKeySize), 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := shares[0].Words()
+
+	// Replace one word of the value with another valid word
+	typo := append([]string(nil), words...)
+	typo[escrowHeaderSize] = wordlist[wordIndex[typo[escrowHeaderSize]]+1]
+	if _, err := ParseEscrowShare(strings.Join(typo, " ")); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("a share with a typo parsed with %v, want a checksum mismatch", err)
+	}
+
+	if _, err := ParseEscrowShare(strings.Join(words[:len(words)-1], " ")); err == nil {
+		t.Error("a share missing a word parsed")
+	}
+}
+
+func TestCombineEscrowSharesMixedSets(t *testing.T) {
+	escrow := bytes.Repeat([]byte{2}, escrowKeySize)
+	first, err := SplitEscrowKey(escrow, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SplitEscrowKey(escrow, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Splits get random set numbers, make sure these two differ
+	for i := range second {
+		second[i].Set = first[0].Set + 1
+	}
+
+	var mixed []EscrowShare
+	for _, s := range []EscrowShare{first[0], second[1]} {
+		parsed, err := ParseEscrowShare(strings.Join(s.Words(), " "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mixed = append(mixed, parsed)
+	}
+	if _, err := CombineEscrowShares(mixed); err == nil || !strings.Contains(err.Error(), "different splits") {
+		t.Errorf("combining shares of different splits returned %v", err)
+	}
+
+	if _, err := CombineEscrowShares(first[:1]); err == nil {
+		t.Error("combining fewer shares than the threshold succeeded")
+	}
+}
@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+)
+
+// Master password requirements
+const (
+	minPasswordLength = 8
+	// strongPasswordBits is the estimated entropy below which a new master
+	// password needs an explicit confirmation
+	strongPasswordBits = 60
+)
+
+// ErrWeakPassword is returned when a new master password is too short.
+var ErrWeakPassword = fmt.Errorf("master password must be at least %d characters long", minPasswordLength)
+
+// PasswordEntropy estimates the entropy of a password in bits from its
+// length and the character classes it uses. Repeated characters only count
+// once, so "aaaaaaaa" scores far below eight random letters.
+func PasswordEntropy(password []byte) float64 {
+	var lower, upper, digit, symbol, other bool
+	seen := map[rune]bool{}
+	for _, r := range string(password) {
+		seen[r] = true
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(len(seen)) * math.Log2(float64(pool))
+}
+
+// checkNewPassword refuses master passwords that are too short and reports
+// whether the password is weak enough to warrant a confirmation
+func checkNewPassword(password []byte) (weak bool, err error) {
+	if len([]rune(string(password))) < minPasswordLength {
+		return false, ErrWeakPassword
+	}
+	return PasswordEntropy(password) < strongPasswordBits, nil
+}
@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armadi1809/vaulta/ui"
+)
+
+// TOTP defaults, used when an otpauth URI leaves them out
+const (
+	defaultTOTPDigits = 6
+	defaultTOTPPeriod = 30 * time.Second
+)
+
+// TOTP holds the parameters of a time-based one-time password generator, as
+// defined by RFC 6238.
+type TOTP struct {
+	Secret []byte
+	// Algorithm is the HMAC hash, one of SHA1, SHA256 and SHA512.
+	Algorithm string
+	Digits    int
+	Period    time.Duration
+}
+
+// ParseTOTP parses a TOTP secret given either in base32, as shown by most
+// sites next to their QR code, or as an otpauth://totp/ URI. Spaces, dashes
+// and padding in base32 secrets are ignored.
+func ParseTOTP(s string) (TOTP, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(strings.ToLower(s), "otpauth:") {
+		secret, err := decodeTOTPSecret(s)
+		if err != nil {
+			return TOTP{}, err
+		}
+		return TOTP{Secret: secret, Algorithm: "SHA1", Digits: defaultTOTPDigits, Period: defaultTOTPPeriod}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return TOTP{}, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return TOTP{}, fmt.Errorf("unsupported one-time password type %q, only totp is supported", u.Host)
+	}
+	query := u.Query()
+	t := TOTP{Algorithm: "SHA1", Digits: defaultTOTPDigits, Period: defaultTOTPPeriod}
+	if t.Secret, err = decodeTOTPSecret(query.Get("secret")); err != nil {
+		return TOTP{}, err
+	}
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		t.Algorithm = strings.ToUpper(algorithm)
+		if _, err := totpHash(t.Algorithm); err != nil {
+			return TOTP{}, err
+		}
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if t.Digits, err = strconv.Atoi(digits); err != nil || t.Digits < 6 || t.Digits > 8 {
+			return TOTP{}, fmt.Errorf("invalid TOTP digits %q, expected 6 to 8", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		seconds, err := strconv.Atoi(period)
+		if err != nil || seconds <= 0 {
+			return TOTP{}, fmt.Errorf("invalid TOTP period %q, expected a number of seconds", period)
+		}
+		t.Period = time.Duration(seconds) * time.Second
+	}
+	return t, nil
+}
+
+// decodeTOTPSecret decodes a base32 TOTP secret
+func decodeTOTPSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(s))
+	if s == "" {
+		return nil, fmt.Errorf("the TOTP secret is empty")
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("the TOTP secret is not valid base32")
+	}
+	return secret, nil
+}
+
+// totpHash returns the hash function of an HMAC algorithm name
+func totpHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported TOTP algorithm %q, expected one of SHA1, SHA256, SHA512", algorithm)
+}
+
+// Code returns the one-time password valid at the given time.
+func (t TOTP) Code(at time.Time) (string, error) {
+	h, err := totpHash(t.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	counter := uint64(at.Unix()) / uint64(t.Period/time.Second)
+	mac := hmac.New(h, t.Secret)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for range t.Digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%mod), nil
+}
+
+// Remaining returns how long the code valid at the given time stays valid.
+func (t TOTP) Remaining(at time.Time) time.Duration {
+	period := int64(t.Period / time.Second)
+	return time.Duration(period-at.Unix()%period) * time.Second
+}
+
+// OTP returns the current one-time password of an entry formatted for
+// output, or copies it to the clipboard with copy, clearing it after
+// clearAfter like CopyEntry.
+func (v *Vault) OTP(name string, copy bool, clearAfter time.Duration) (string, error) {
+	v.logo()
+	v.title("🔢 One-Time Password")
+
+	entry, err := v.accessEntry(name)
+	if err != nil {
+		return "", err
+	}
+	if entry.TOTP == "" {
+		return "", fmt.Errorf("entry '%s' has no TOTP secret, add one with 'vaulta edit %s --set totp=<secret>'", name, name)
+	}
+	totp, err := ParseTOTP(entry.TOTP)
+	if err != nil {
+		return "", err
+	}
+	at := now()
+	code, err := totp.Code(at)
+	if err != nil {
+		return "", err
+	}
+	remaining := totp.Remaining(at)
+
+	if copy {
+		return "", v.copyAndClear(code, fmt.Sprintf("one-time password of '%s'", name), clearAfter)
+	}
+	switch v.format {
+	case FormatJSON:
+		return marshalJSON(otpOutput{Code: code, Remaining: int(remaining.Seconds()), Period: int(totp.Period.Seconds())})
+	case FormatYAML:
+		return marshalYAML(otpOutput{Code: code, Remaining: int(remaining.Seconds()), Period: int(totp.Period.Seconds())})
+	case FormatRaw:
+		return code, nil
+	default:
+		return ui.RenderInfo(name, ui.ValueStyle.Render(code)+"\n\n"+ui.DimStyle.Render(fmt.Sprintf("valid for %s", remaining))), nil
+	}
+}
+
+// otpOutput is the machine readable form of a one-time password
+type otpOutput struct {
+	Code      string `json:"code"`
+	Remaining int    `json:"remaining_seconds"`
+	Period    int    `json:"period_seconds"`
+}
@@ -0,0 +1,127 @@
+package vault
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B. The seed of each algorithm is the ASCII string
+	// "12345678901234567890" repeated to the length of its hash.
+	seeds := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	tests := []struct {
+		unix      int64
+		algorithm string
+		want      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, test := range tests {
+		totp := TOTP{Secret: seeds[test.algorithm], Algorithm: test.algorithm, Digits: 8, Period: 30 * time.Second}
+		got, err := totp.Code(time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s code at %d = %s, want %s", test.algorithm, test.unix, got, test.want)
+		}
+	}
+}
+
+func TestTOTPCodeDigits(t *testing.T) {
+	// The 6 digit code is the last 6 digits of the 8 digit one
+	totp := TOTP{Secret: []byte("12345678901234567890"), Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	got, err := totp.Code(time.Unix(1111111109, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "081804" {
+		t.Errorf("6 digit code = %s, want 081804", got)
+	}
+}
+
+func TestTOTPRemaining(t *testing.T) {
+	totp := TOTP{Period: 30 * time.Second}
+	for unix, want := range map[int64]time.Duration{0: 30 * time.Second, 29: time.Second, 59: time.Second, 61: 29 * time.Second} {
+		if got := totp.Remaining(time.Unix(unix, 0)); got != want {
+			t.Errorf("Remaining at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestParseTOTP(t *testing.T) {
+	// "12345678901234567890" in base32
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		input string
+		want  TOTP
+	}{
+		{secret, TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}},
+		{"gezd gnbv gy3t qojq gezd gnbv gy3t qojq", TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}},
+		{"GEZD-GNBV-GY3T-QOJQ-GEZD-GNBV-GY3T-QOJQ", TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}},
+		{"otpauth://totp/Example:me?secret=" + secret + "&issuer=Example", TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}},
+		{"otpauth://totp/x?secret=" + secret + "&algorithm=sha256&digits=8&period=60", TOTP{Algorithm: "SHA256", Digits: 8, Period: time.Minute}},
+		{"otpauth://totp/x?secret=" + secret + "&algorithm=SHA512&digits=7", TOTP{Algorithm: "SHA512", Digits: 7, Period: 30 * time.Second}},
+	}
+	for _, test := range tests {
+		got, err := ParseTOTP(test.input)
+		if err != nil {
+			t.Errorf("ParseTOTP(%q): %v", test.input, err)
+			continue
+		}
+		if !bytes.Equal(got.Secret, []byte("12345678901234567890")) {
+			t.Errorf("ParseTOTP(%q) secret = %q", test.input, got.Secret)
+		}
+		if got.Algorithm != test.want.Algorithm || got.Digits != test.want.Digits || got.Period != test.want.Period {
+			t.Errorf("ParseTOTP(%q) = %s, %d digits, %s, want %s, %d digits, %s", test.input,
+				got.Algorithm, got.Digits, got.Period, test.want.Algorithm, test.want.Digits, test.want.Period)
+		}
+	}
+}
+
+func TestParseTOTPErrors(t *testing.T) {
+	const uri = "otpauth://totp/x?secret=GEZDGNBVGY3TQOJQ"
+	tests := map[string]string{
+		"":                 "empty",
+		"not base32!":      "base32",
+		"otpauth://totp/x": "empty",
+		"otpauth://hotp/x?secret=GEZDGNBVGY3TQOJQ": "only totp",
+		uri + "&digits=5":                          "digits",
+		uri + "&digits=9":                          "digits",
+		uri + "&digits=six":                        "digits",
+		uri + "&period=0":                          "period",
+		uri + "&period=-30":                        "period",
+		uri + "&period=30s":                        "period",
+		uri + "&algorithm=MD5":                     "algorithm",
+	}
+	for input, want := range tests {
+		_, err := ParseTOTP(input)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseTOTP(%q) returned %v, want an error about %s", input, err, want)
+		}
+	}
+}
@@ -1,23 +1,23 @@
 package vault
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/armadi1809/vaulta/config"
 	"github.com/armadi1809/vaulta/ui"
-	"golang.org/x/crypto/argon2"
 )
 
-// KDF configuration constants
+// Default KDF configuration
 const (
 	kdfIterations  uint32 = 3
 	kdfMemory      uint32 = 64 * 1024
@@ -27,9 +27,12 @@ const (
 )
 
 type VaultFile struct {
-	Version int       `json:"version"`
-	KDF     KDFConfig `json:"kdf"`
-	Cipher  Cipher    `json:"cipher"`
+	Version int `json:"version"`
+	// KDF is only set in files before version 3, where the key derived from
+	// the master password encrypted the payload directly.
+	KDF      *KDFConfig `json:"kdf,omitempty"`
+	KeySlots []KeySlot  `json:"keyslots,omitempty"`
+	Cipher   Cipher     `json:"cipher"`
 }
 
 type KDFConfig struct {
@@ -46,20 +49,33 @@ type Cipher struct {
 	Data      string `json:"data"`
 }
 
-type Entry struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
 type VaultData struct {
-	Entries map[string]Entry `json:"entries"`
+	Schema    int              `json:"schema"`
+	Entries   map[string]Entry `json:"entries"`
+	Retention *RetentionPolicy `json:"retention,omitempty"`
 }
 
 type Vault struct {
-	path string
+	path           string
+	prompter       Prompter
+	passwordSource PasswordSource
+	keyfile        string
+	format         Format
+	stdout         io.Writer
+	stderr         io.Writer
 }
 
-func New(path string) (*Vault, error) {
+// Option configures a Vault
+type Option func(*Vault)
+
+// WithPrompter sets the prompter used to ask for passwords and entry details
+func WithPrompter(p Prompter) Option {
+	return func(v *Vault) {
+		v.prompter = p
+	}
+}
+
+func New(path string, opts ...Option) (*Vault, error) {
 	if path == "" {
 		var err error
 		path, err = config.DefaultVaultPath()
@@ -67,120 +83,127 @@ func New(path string) (*Vault, error) {
 			return nil, err
 		}
 	}
-	return &Vault{path: path}, nil
-}
-
-// deriveKey derives an encryption key from a password and salt using Argon2id
-func deriveKey(password, salt []byte) []byte {
-	return argon2.IDKey(password, salt, kdfIterations, kdfMemory, kdfParallelism, kdfKeyLength)
-}
-
-// encrypt encrypts plaintext using AES-256-GCM and returns nonce and ciphertext
-func encrypt(key, plaintext []byte) (nonce, ciphertext []byte, err error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, nil, err
+	v := &Vault{path: path, format: FormatText, stdout: os.Stdout, stderr: os.Stderr}
+	for _, opt := range opts {
+		opt(v)
+	}
+	if v.prompter == nil {
+		v.prompter = DefaultPrompter()
 	}
+	return v, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// readVaultFile reads and parses the vault JSON file. It also returns the
+// SHA-256 of the file, which Save compares to detect changes made by another
+// process.
+func readVaultFile(path string) (*VaultFile, []byte, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	nonce, err = randomBytes(gcm.NonceSize())
-	if err != nil {
+	var vault VaultFile
+	if err = json.Unmarshal(data, &vault); err != nil {
 		return nil, nil, err
 	}
 
-	ciphertext = gcm.Seal(nil, nonce, plaintext, nil)
-	return nonce, ciphertext, nil
+	sum := sha256.Sum256(data)
+	return &vault, sum[:], nil
 }
 
-// decrypt decrypts ciphertext using AES-256-GCM
-func decrypt(key, nonce, ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+// writeVaultFile atomically replaces the vault file at path, keeping the
+// previous one as a backup if backup is set, see writeFileAtomic. It returns
+// the SHA-256 of the new file.
+func writeVaultFile(path string, vault *VaultFile, backup bool) ([]byte, error) {
+	data, err := json.MarshalIndent(vault, "", "  ")
 	if err != nil {
 		return nil, err
 	}
+	data = append(data, '\n')
 
-	gcm, err := cipher.NewGCM(block)
+	err = writeFileAtomic(path, backup, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, errors.New("invalid password or corrupted vault")
-	}
-
-	return plaintext, nil
+	sum := sha256.Sum256(data)
+	return sum[:], nil
 }
 
-// readVaultFile reads and parses the vault JSON file
-func readVaultFile(path string) (*VaultFile, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var vault VaultFile
-	if err = json.NewDecoder(f).Decode(&vault); err != nil {
-		return nil, err
+// newVaultFile creates a new VaultFile without key slots, encrypted with
+// cipherAlgorithm. The cipher data is filled in when the vault is saved.
+func newVaultFile(cipherAlgorithm string) *VaultFile {
+	return &VaultFile{
+		Version: currentVersion,
+		Cipher: Cipher{
+			Algorithm: cipherAlgorithm,
+		},
 	}
-
-	return &vault, nil
 }
 
-// writeVaultFile writes the vault to a JSON file
-func writeVaultFile(path string, vault *VaultFile) error {
-	// Ensure the parent directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
+// checkKDFParams refuses KDF parameters outside the supported bounds before
+// any key is derived with them
+func (v *VaultFile) checkKDFParams() error {
+	configs := []KDFConfig{}
+	if v.KDF != nil {
+		configs = append(configs, *v.KDF)
 	}
-
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return err
+	for _, slot := range v.KeySlots {
+		configs = append(configs, slot.KDF)
 	}
-	defer file.Close()
-
-	enc := json.NewEncoder(file)
-	enc.SetIndent("", "  ")
-	return enc.Encode(vault)
+	for _, config := range configs {
+		if err := config.params().Validate(); err != nil {
+			return fmt.Errorf("invalid key derivation parameters in vault: %w", err)
+		}
+	}
+	return nil
 }
 
-// promptPassword prompts the user for a password using the TUI
-func promptPassword(prompt string) ([]byte, error) {
-	pwd, err := ui.PromptPassword(prompt)
-	if err != nil {
-		return nil, err
+// checkAlgorithms refuses vault files using algorithms vaulta does not know
+func (v *VaultFile) checkAlgorithms() error {
+	if len(v.KeySlots) == 0 {
+		return errors.New("the vault has no key slots")
+	}
+	for _, slot := range v.KeySlots {
+		switch slot.Type {
+		case SlotPassword, SlotKeyfile, SlotPasswordKeyfile, SlotRecovery, SlotEscrow:
+		default:
+			return fmt.Errorf("unsupported key slot type %q", slot.Type)
+		}
+		if slot.KDF.Algorithm != "argon2id" {
+			return fmt.Errorf("unsupported key derivation algorithm %q", slot.KDF.Algorithm)
+		}
 	}
-	return []byte(pwd), nil
+	return checkCipher(v.Cipher.Algorithm)
 }
 
-func promptNormal(prompt string, icon string) (string, error) {
-	return ui.PromptText(prompt, icon)
-}
-
-// newVaultFile creates a new VaultFile with the given salt, nonce, and ciphertext
-func newVaultFile(salt, nonce, ciphertext []byte) *VaultFile {
-	return &VaultFile{
-		Version: 1,
-		KDF: KDFConfig{
-			Algorithm:   "argon2id",
-			Salt:        base64.StdEncoding.EncodeToString(salt),
-			Iterations:  kdfIterations,
-			Memory:      kdfMemory,
-			Parallelism: kdfParallelism,
-		},
-		Cipher: Cipher{
-			Algorithm: "aes-256-gcm",
-			Nonce:     base64.StdEncoding.EncodeToString(nonce),
-			Data:      base64.StdEncoding.EncodeToString(ciphertext),
-		},
-	}
+// additionalData returns the canonical encoding of the vault header that is
+// authenticated along with the payload, so tampering with the format version
+// or the cipher algorithm makes unlocking fail. Key slots authenticate their
+// own KDF parameters, see KeySlot.additionalData. Files before version 2 did
+// not authenticate their header, and version 2 bound the single KDF block.
+func (v *VaultFile) additionalData() []byte {
+	var header any
+	switch {
+	case v.Version < 2:
+		return nil
+	case v.Version == 2:
+		header = struct {
+			Version int        `json:"version"`
+			KDF     *KDFConfig `json:"kdf"`
+			Cipher  string     `json:"cipher"`
+		}{v.Version, v.KDF, v.Cipher.Algorithm}
+	default:
+		header = struct {
+			Version int    `json:"version"`
+			Cipher  string `json:"cipher"`
+		}{v.Version, v.Cipher.Algorithm}
+	}
+
+	data, _ := json.Marshal(header)
+	return data
 }
 
 // updateVaultCipher updates the cipher data in an existing vault
@@ -190,279 +213,510 @@ func (v *VaultFile) updateCipher(nonce, ciphertext []byte) {
 }
 
 // decodeVaultCipher decodes the base64-encoded cipher components
-func (v *VaultFile) decodeCipher() (salt, nonce, ciphertext []byte, err error) {
-	salt, err = base64.StdEncoding.DecodeString(v.KDF.Salt)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
+func (v *VaultFile) decodeCipher() (nonce, ciphertext []byte, err error) {
 	nonce, err = base64.StdEncoding.DecodeString(v.Cipher.Nonce)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, err
 	}
 
 	ciphertext, err = base64.StdEncoding.DecodeString(v.Cipher.Data)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, err
 	}
 
-	return salt, nonce, ciphertext, nil
+	return nonce, ciphertext, nil
 }
 
-func (v *Vault) InitVault() error {
+// InitVault creates a new vault protected by the master password, the
+// keyfile configured with WithKeyfile, or both. noPassword creates a vault
+// unlocked by the keyfile alone.
+func (v *Vault) InitVault(noPassword bool, opts ...CreateOption) error {
+	if noPassword && v.keyfile == "" {
+		return errors.New("a vault without a master password needs a keyfile")
+	}
 	path := v.path
-	fmt.Println(ui.RenderLogo())
+	v.logo()
 	if exist := checkFileExists(path); exist {
-		text, err := promptNormal("A Vaulta vault already exists, do you want to overwrite it? (y/n)", ui.IconWarning)
+		overwrite, err := v.prompter.Confirm("A Vaulta vault already exists, do you want to overwrite it?")
 		if err != nil {
 			return err
 		}
-		if strings.ToLower(text) != "y" {
-			fmt.Println(ui.RenderInfo("Info", "Vault initialization cancelled. Vault remains unchanged."))
+		if !overwrite {
+			v.println(ui.RenderInfo("Info", "Vault initialization cancelled. Vault remains unchanged."))
 			return nil
 		}
 	}
-	fmt.Println(ui.TitleStyle.Render("🔐 Initialize New Vault"))
-	fmt.Println()
+	v.title("🔐 Initialize New Vault")
 
-	masterPwd, err := promptPassword("Choose a master password")
-	if err != nil {
-		return err
+	var key Key
+	var err error
+	if v.keyfile != "" {
+		if key.Keyfile, err = ReadKeyfile(v.keyfile); err != nil {
+			return err
+		}
 	}
-
-	salt, err := randomBytes(saltSize)
-	if err != nil {
-		return err
+	if !noPassword {
+		key.Password, err = v.masterPassword("Choose a master password")
+		if err != nil {
+			key.zero()
+			return err
+		}
 	}
 
-	key := deriveKey(masterPwd, salt)
-	zero(masterPwd)
-
-	plaintext := []byte(`{"entries":{}}`)
-	nonce, ciphertext, err := encrypt(key, plaintext)
+	session, err := CreateKey(path, key, opts...)
+	key.zero()
 	if err != nil {
 		return err
 	}
+	session.Close()
 
-	zero(plaintext)
-	zero(key)
+	v.println(ui.RenderSuccess("Vault initialized successfully!"))
+	v.println(ui.DimStyle.Render("  Your encrypted vault is ready to use."))
+	v.println()
+	return nil
+}
 
-	vault := newVaultFile(salt, nonce, ciphertext)
-	err = writeVaultFile(path, vault)
+// unlock prompts for the master password and opens the vault
+func (v *Vault) unlock() (*Session, error) {
+	session, masterPwd, err := v.unlockWithPassword()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	zero(masterPwd)
 
-	fmt.Println(ui.RenderSuccess("Vault initialized successfully!"))
-	fmt.Println(ui.DimStyle.Render("  Your encrypted vault is ready to use."))
-	fmt.Println()
-	return nil
+	if session.KDFParams().Weak() {
+		fmt.Fprintln(v.stderr, ui.RenderWarning("This vault uses weaker key derivation settings than the current defaults. Run 'vaulta kdf upgrade' to strengthen them."))
+	}
+	return session, nil
 }
 
-func unlockVault(path string) ([]byte, *VaultFile, []byte, error) {
-	vault, err := readVaultFile(path)
+// unlockWithPassword opens the vault and returns the master password it was
+// unlocked with, which the caller must zero. A keyfile that may unlock the
+// vault on its own is tried before asking for the master password.
+func (v *Vault) unlockWithPassword() (*Session, []byte, error) {
+	file, _, err := readVaultFile(v.path)
 	if err != nil {
-		return nil, nil, nil, err
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, ErrNoVault
+		}
+		return nil, nil, err
 	}
 
-	masterPwd, err := promptPassword("Enter your master password")
-	if err != nil {
-		return nil, nil, nil, err
+	var key Key
+	if v.keyfile != "" {
+		if key.Keyfile, err = ReadKeyfile(v.keyfile); err != nil {
+			return nil, nil, err
+		}
+		defer zero(key.Keyfile)
+		if file.checkFactors(factorKeyfile) == nil {
+			session, err := OpenKey(v.path, key)
+			if err == nil || !errors.Is(err, ErrInvalidPassword) || !file.usesPassword() {
+				return session, nil, err
+			}
+		}
+	}
+	if err := file.checkFactors(factorPassword | key.factors()); err != nil {
+		return nil, nil, err
 	}
 
-	salt, nonce, ciphertext, err := vault.decodeCipher()
+	key.Password, err = v.masterPassword("Enter your master password")
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, err
 	}
-
-	key := deriveKey(masterPwd, salt)
-	zero(masterPwd)
-
-	plaintext, err := decrypt(key, nonce, ciphertext)
+	session, err := OpenKey(v.path, key)
 	if err != nil {
-		zero(key)
-		return nil, nil, nil, err
+		zero(key.Password)
+		return nil, nil, err
 	}
+	return session, key.Password, nil
+}
 
-	return plaintext, vault, key, nil
+// AddOptions holds entry details supplied up front, e.g. from command line
+// flags. Missing details are prompted for.
+type AddOptions struct {
+	Name     string
+	Username string
+	Secret   []byte
+	URLs     []string
+	Notes    string
+	Tags     []string
+	Fields   []Field
+	// TOTP is a TOTP secret in base32 or as an otpauth URI.
+	TOTP string
+	// Force replaces an existing entry without asking.
+	Force bool
+	// NoClobber fails instead of replacing an existing entry.
+	NoClobber bool
+	// Generate stores a secret generated with these options, unless Secret
+	// is set.
+	Generate *GenerateOptions
 }
 
-func AddEntry() error {
-	path, err := config.DefaultVaultPath()
-	if err != nil {
-		return err
+func (v *Vault) AddEntry(opts AddOptions) error {
+	v.logo()
+	v.title("➕ Add New Entry")
+
+	var err error
+	name := opts.Name
+	if name == "" {
+		name, err = v.prompter.Text("Entry name", ui.IconInfo)
+		if err != nil {
+			return err
+		}
+	}
+	if normalizeName(name) == "" {
+		return ErrEmptyName
+	}
+	if opts.TOTP != "" {
+		if _, err := ParseTOTP(opts.TOTP); err != nil {
+			return err
+		}
 	}
-	fmt.Println(ui.RenderLogo())
-	fmt.Println(ui.TitleStyle.Render("➕ Add New Entry"))
-	fmt.Println()
 
-	notes, err := promptNormal("What is this entry for?", ui.IconInfo)
-	if err != nil {
-		return err
+	// Only ask for the username when the secret is entered interactively
+	// too, scripts supplying the secret may leave it empty.
+	username := opts.Username
+	secret := opts.Secret
+	var generatedBits float64
+	if secret == nil && opts.Generate != nil {
+		secret, generatedBits, err = Generate(*opts.Generate)
+		if err != nil {
+			return err
+		}
+		defer zero(secret)
+	}
+	if secret == nil {
+		if username == "" {
+			username, err = v.prompter.Text("Enter username or secret description", "👤")
+			if err != nil {
+				return err
+			}
+		}
+		secret, err = v.prompter.Password("Enter secret")
+		if err != nil {
+			return err
+		}
+		defer zero(secret)
 	}
-	username, err := promptNormal("Enter username or secret description", "👤")
+
+	session, err := v.unlock()
 	if err != nil {
 		return err
 	}
-	password, err := promptPassword("Enter secret")
-	if err != nil {
-		return err
+	defer session.Close()
+
+	entry := Entry{
+		Username: username,
+		Password: string(secret),
+		URLs:     opts.URLs,
+		Notes:    opts.Notes,
+		Tags:     opts.Tags,
+		TOTP:     strings.TrimSpace(opts.TOTP),
+	}
+	for _, field := range opts.Fields {
+		if err := entry.SetField(field); err != nil {
+			return err
+		}
 	}
 
-	plaintext, vault, key, err := unlockVault(path)
-	if err != nil {
-		return err
+	if old, err := session.Get(name); err == nil {
+		if opts.NoClobber {
+			return fmt.Errorf("%w: '%s'", ErrEntryExists, name)
+		}
+		if !opts.Force {
+			v.println(ui.RenderChanges(name, entryChanges(old, entry)))
+			replace, err := v.prompter.Confirm(fmt.Sprintf("Entry '%s' already exists, replace it?", name))
+			if err != nil {
+				return err
+			}
+			if !replace {
+				v.println(ui.RenderInfo("Info", "Entry unchanged."))
+				return nil
+			}
+		}
 	}
-	defer zero(key)
 
-	var data VaultData
-	if err := json.Unmarshal(plaintext, &data); err != nil {
+	if err := session.Put(name, entry); err != nil {
 		return err
 	}
-
-	if data.Entries == nil {
-		data.Entries = make(map[string]Entry)
+	if err := session.Save(); err != nil {
+		return err
 	}
 
-	data.Entries[strings.ToLower(notes)] = Entry{
-		Username: username,
-		Password: string(password),
+	v.println(ui.RenderSuccess(fmt.Sprintf("Entry '%s' added successfully!", name)))
+	if generatedBits > 0 {
+		v.println(ui.DimStyle.Render(fmt.Sprintf("  The secret was generated with %s. Run 'vaulta get %s --copy' to use it.", entropyText(generatedBits), name)))
 	}
+	v.println()
+	return nil
+}
 
-	updatedPlaintext, err := json.Marshal(data)
+// EditEntry updates an existing entry. Each of sets is a field=value pair
+// applied without prompting; when there are none, every field is prompted for
+// pre-filled with its current value.
+func (v *Vault) EditEntry(name string, sets []string) error {
+	v.logo()
+	v.title("✏️  Edit Entry")
+
+	session, err := v.unlock()
 	if err != nil {
 		return err
 	}
+	defer session.Close()
 
-	nonce, ciphertext, err := encrypt(key, updatedPlaintext)
+	entry, err := session.Get(name)
+	if errors.Is(err, ErrEntryNotFound) {
+		return entryNotFound(session, name)
+	}
 	if err != nil {
 		return err
 	}
 
-	vault.updateCipher(nonce, ciphertext)
-	err = writeVaultFile(path, vault)
-	if err != nil {
+	if len(sets) > 0 {
+		for _, set := range sets {
+			field, value, ok := strings.Cut(set, "=")
+			if !ok {
+				return fmt.Errorf("invalid assignment %q, expected field=value", set)
+			}
+			if err := entry.setField(field, value); err != nil {
+				return err
+			}
+		}
+	} else {
+		entry, err = v.editFields(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := session.Put(name, entry); err != nil {
+		return err
+	}
+	if err := session.Save(); err != nil {
 		return err
 	}
 
-	fmt.Println(ui.RenderSuccess(fmt.Sprintf("Entry '%s' added successfully!", notes)))
-	fmt.Println()
+	v.println(ui.RenderSuccess(fmt.Sprintf("Entry '%s' updated successfully!", name)))
+	v.println()
 	return nil
 }
 
-func (v *Vault) GetEntry(note string) (string, error) {
-	path := v.path
-	fmt.Println(ui.RenderLogo())
-	fmt.Println(ui.TitleStyle.Render("🔍 Retrieve Entry"))
-	fmt.Println()
+// editFields prompts for every field of entry, pre-filled with its value
+func (v *Vault) editFields(entry Entry) (Entry, error) {
+	var err error
+	entry.Username, err = v.prompter.EditText("Username or secret description", "👤", entry.Username)
+	if err != nil {
+		return entry, err
+	}
+	secret, err := v.prompter.EditPassword("Secret", []byte(entry.Password))
+	if err != nil {
+		return entry, err
+	}
+	entry.Password = string(secret)
+	urls, err := v.prompter.EditText("URLs (comma separated)", "🔗", strings.Join(entry.URLs, ", "))
+	if err != nil {
+		return entry, err
+	}
+	entry.URLs = splitTags(urls)
+	entry.Notes, err = v.prompter.EditText("Notes", ui.IconInfo, entry.Notes)
+	if err != nil {
+		return entry, err
+	}
+	tags, err := v.prompter.EditText("Tags (comma separated)", "🏷", strings.Join(entry.Tags, ", "))
+	if err != nil {
+		return entry, err
+	}
+	entry.Tags = splitTags(tags)
+	if entry.TOTP != "" {
+		totp, err := v.prompter.EditPassword("TOTP secret or otpauth URI", []byte(entry.TOTP))
+		if err != nil {
+			return entry, err
+		}
+		if err := entry.setField("totp", string(totp)); err != nil {
+			return entry, err
+		}
+	}
+	for _, field := range entry.Fields {
+		if field.Type == FieldHidden {
+			value, err := v.prompter.EditPassword(field.Name, []byte(field.Value))
+			if err != nil {
+				return entry, err
+			}
+			field.Value = string(value)
+		} else {
+			field.Value, err = v.prompter.EditText(field.Name, "✎", field.Value)
+			if err != nil {
+				return entry, err
+			}
+		}
+		if err := entry.SetField(field); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// GetEntry returns an entry formatted for output. In text mode, its password
+// and hidden fields are masked unless show is set.
+func (v *Vault) GetEntry(note string, show bool) (string, error) {
+	v.logo()
+	v.title("🔍 Retrieve Entry")
 
-	plaintext, _, key, err := unlockVault(path)
+	entry, err := v.accessEntry(note)
 	if err != nil {
 		return "", err
 	}
-	defer zero(key)
+	return v.formatEntry(note, entry, show)
+}
 
-	var data VaultData
-	if err := json.Unmarshal(plaintext, &data); err != nil {
-		return "", err
+// accessGranularity is how often reading an entry updates its access time
+const accessGranularity = time.Minute
+
+// accessEntry unlocks the vault, returns the entry stored under name and
+// records the access. The vault is closed again before returning.
+func (v *Vault) accessEntry(name string) (Entry, error) {
+	session, err := v.unlock()
+	if err != nil {
+		return Entry{}, err
 	}
+	defer session.Close()
 
-	if entry, ok := data.Entries[strings.ToLower(note)]; ok {
-		return ui.RenderEntry(note, entry.Username, entry.Password), nil
+	entry, err := session.Get(name)
+	if errors.Is(err, ErrEntryNotFound) {
+		return Entry{}, entryNotFound(session, name)
+	}
+	if err != nil {
+		return Entry{}, err
 	}
 
-	return "", errors.New("entry not found. Try 'vault list' to see all entries")
+	// The access time is only informative. Recording it rewrites the whole
+	// vault, so it is refreshed at most once per accessGranularity, and a
+	// vault that cannot be written, for example on a read-only mount, is
+	// read without it. Other failures are reported but do not fail the
+	// access.
+	if now().Sub(entry.Accessed) < accessGranularity {
+		return entry, nil
+	}
+	err = session.Touch(name)
+	if err == nil {
+		err = session.saveAccess()
+	}
+	if err != nil && !errors.Is(err, os.ErrPermission) && !isReadOnlyFS(err) {
+		fmt.Fprintln(v.stderr, ui.RenderWarning(fmt.Sprintf("Could not record the access time: %v", err)))
+	}
+	return entry, nil
 }
 
-func (v *Vault) ListEntries() (string, error) {
-	fmt.Println(ui.RenderLogo())
-	fmt.Println(ui.TitleStyle.Render("📋 List All Entries"))
-	fmt.Println()
-	path := v.path
-	plaintext, _, key, err := unlockVault(path)
+// ListEntries returns the entries selected by opts, formatted for output.
+func (v *Vault) ListEntries(opts ListOptions) (string, error) {
+	v.logo()
+	v.title("📋 List All Entries")
+
+	session, err := v.unlock()
 	if err != nil {
 		return "", err
 	}
-	defer zero(key)
+	defer session.Close()
 
-	var data VaultData
-	if err := json.Unmarshal(plaintext, &data); err != nil {
+	names, err := selectEntries(session.data.Entries, opts)
+	if err != nil {
 		return "", err
 	}
 
-	var entries []string
-	for k := range data.Entries {
-		entries = append(entries, k)
-	}
-
-	return ui.RenderList("Stored Entries", entries), nil
+	return v.formatList("Stored Entries", names, session.data.Entries)
 }
 
-func (v *Vault) DeleteEntry(note string) error {
-	fmt.Println(ui.RenderLogo())
-	fmt.Println(ui.TitleStyle.Render("🗑️  Delete Entry"))
-	fmt.Println()
-	path := v.path
+// SearchEntries returns the entries matching query, best matches first,
+// formatted for output. See Session.Search.
+func (v *Vault) SearchEntries(query string) (string, error) {
+	v.logo()
+	v.title("🔎 Search Entries")
 
-	plaintext, vault, key, err := unlockVault(path)
+	session, err := v.unlock()
 	if err != nil {
-		return err
-	}
-	defer zero(key)
-
-	var data VaultData
-	if err := json.Unmarshal(plaintext, &data); err != nil {
-		return err
+		return "", err
 	}
+	defer session.Close()
 
-	if data.Entries == nil {
-		return errors.New("the vault is empty")
+	names, err := session.Search(query)
+	if err != nil {
+		return "", err
 	}
-	note_l := strings.ToLower(note)
 
-	if _, exists := data.Entries[note_l]; !exists {
-		return fmt.Errorf("entry '%s' not found in vault", note)
-	}
+	return v.formatList(fmt.Sprintf("Entries matching '%s'", query), names, session.data.Entries)
+}
 
-	delete(data.Entries, note_l)
+func (v *Vault) DeleteEntry(note string) error {
+	v.logo()
+	v.title("🗑️  Delete Entry")
 
-	updatedPlaintext, err := json.Marshal(data)
+	session, err := v.unlock()
 	if err != nil {
 		return err
 	}
-	nonce, ciphertext, err := encrypt(key, updatedPlaintext)
-	if err != nil {
+	defer session.Close()
+
+	if err := session.Delete(note); err != nil {
+		if errors.Is(err, ErrEntryNotFound) {
+			return entryNotFound(session, note)
+		}
 		return err
 	}
-
-	vault.updateCipher(nonce, ciphertext)
-
-	err = writeVaultFile(path, vault)
-	if err != nil {
+	if err := session.Save(); err != nil {
 		return err
 	}
 
-	fmt.Println(ui.RenderSuccess(fmt.Sprintf("Entry '%s' deleted successfully!", note)))
-	fmt.Println()
+	v.println(ui.RenderSuccess(fmt.Sprintf("Entry '%s' deleted successfully!", note)))
+	v.println()
 	return nil
 }
 
 func (v *Vault) ResetEntry() error {
 	path := v.path
-	fmt.Println(ui.RenderLogo())
+	v.logo()
 	if exist := checkFileExists(path); exist {
-		plaintext, _, key, err := unlockVault(path)
+		session, err := v.unlock()
 		if err != nil {
 			return err
 		}
-		zero(plaintext)
-		zero(key)
-		return os.Remove(path)
+		defer session.Close()
+
+		removed, err := removeVaultFiles(path)
+		if err != nil {
+			return err
+		}
+		v.println(ui.RenderSuccess("Vault reset successfully!"))
+		v.println(ui.DimStyle.Render("  Removed " + strings.Join(removed, ", ")))
+		v.println()
+		return nil
 	}
-	fmt.Println(ui.RenderInfo("Info", "No vault exists on your system, initialize one by running the init command"))
+	v.println(ui.RenderInfo("Info", "No vault exists on your system, initialize one by running the init command"))
 	return nil
 }
 
+// removeVaultFiles deletes the vault file at path along with its backups,
+// which still decrypt with the passwords they were written with, and
+// returns the names of the files it removed
+func removeVaultFiles(path string) ([]string, error) {
+	paths := []string{path, path + backupSuffix}
+	for version := 1; version < currentVersion; version++ {
+		paths = append(paths, backupPath(path, version))
+	}
+
+	var removed []string
+	for _, p := range paths {
+		err := os.Remove(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, filepath.Base(p))
+	}
+	return removed, nil
+}
+
 func randomBytes(size int) ([]byte, error) {
 	buf := make([]byte, size)
 	_, err := rand.Read(buf)
@@ -0,0 +1,350 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKDFParams keeps key derivation fast in tests
+var testKDFParams = KDFParams{Time: 1, Memory: minKDFMemory, Threads: 1}
+
+// newTestVault creates a vault with one entry, unlocked by password and
+// other, and returns its path
+func newTestVault(t *testing.T, password, other string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vault.json")
+	session, err := Create(path, []byte(password), WithKDFParams(testKDFParams))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.Put("github", Entry{Username: "me", Password: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.AddKeySlot(Key{Password: []byte(other)}, testKDFParams); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestCLI returns a Vault for the vault at path that answers its prompts
+// from the script and discards its output
+func newTestCLI(t *testing.T, path string, script *ScriptedPrompter) *Vault {
+	t.Helper()
+	v, err := New(path, WithPrompter(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.stdout, v.stderr = io.Discard, io.Discard
+	return v
+}
+
+// openEntry opens the vault at path and returns its entry name
+func openEntry(t *testing.T, path, password, name string) Entry {
+	t.Helper()
+	session, err := Open(path, []byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	entry, err := session.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+// tamper rewrites the header of the vault file at path with change
+func tamper(t *testing.T, path string, change func(*VaultFile)) {
+	t.Helper()
+	file, _, err := readVaultFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(file)
+	if _, err := writeVaultFile(path, file, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// otherSalt returns a different salt of the same length
+func otherSalt(salt string) string {
+	raw, _ := base64.StdEncoding.DecodeString(salt)
+	raw[0] ^= 0xff
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestOpenTamperedHeader(t *testing.T) {
+	const password, other = "correct horse", "battery staple"
+
+	type tamperTest struct {
+		name   string
+		change func(*VaultFile)
+		want   error
+		// refused are the passwords that must no longer unlock the vault,
+		// the others still open it
+		refused []string
+	}
+	both := []string{password, other}
+	tests := []tamperTest{
+		{"newer version", func(f *VaultFile) { f.Version = 4 }, ErrUnsupportedVersion, both},
+		{"negative version", func(f *VaultFile) { f.Version = -1 }, ErrUnsupportedVersion, both},
+		{"version 2", func(f *VaultFile) { f.Version = 2 }, ErrUnsupportedVersion, both},
+		{"version 1", func(f *VaultFile) { f.Version = 1 }, ErrUnsupportedVersion, both},
+		{"cipher algorithm", func(f *VaultFile) { f.Cipher.Algorithm = CipherXChaCha20Poly1305 }, ErrInvalidPassword, both},
+	}
+	// A slot authenticates its own KDF parameters, tampering with them only
+	// locks out the password of that slot
+	for i, pw := range both {
+		slot := func(f *VaultFile) *KDFConfig { return &f.KeySlots[i].KDF }
+		prefix := fmt.Sprintf("slot %d ", i+1)
+		refused := []string{pw}
+		tests = append(tests,
+			tamperTest{prefix + "iterations", func(f *VaultFile) { slot(f).Iterations++ }, ErrInvalidPassword, refused},
+			tamperTest{prefix + "memory", func(f *VaultFile) { slot(f).Memory *= 2 }, ErrInvalidPassword, refused},
+			tamperTest{prefix + "parallelism", func(f *VaultFile) { slot(f).Parallelism++ }, ErrInvalidPassword, refused},
+			tamperTest{prefix + "salt", func(f *VaultFile) { slot(f).Salt = otherSalt(slot(f).Salt) }, ErrInvalidPassword, refused},
+		)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := newTestVault(t, password, other)
+			tamper(t, path, test.change)
+
+			for _, pw := range both {
+				want := test.want
+				if !slices.Contains(test.refused, pw) {
+					want = nil
+				}
+				session, err := Open(path, []byte(pw))
+				if err == nil {
+					session.Close()
+				}
+				if !errors.Is(err, want) {
+					t.Errorf("Open with %q returned %v, want %v", pw, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenXChaCha20Poly1305(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	session, err := Create(path, []byte("correct horse"), WithKDFParams(testKDFParams), WithCipher(CipherXChaCha20Poly1305))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Put("github", Entry{Username: "me", Password: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	file, _, err := readVaultFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Cipher.Algorithm != CipherXChaCha20Poly1305 {
+		t.Errorf("vault is encrypted with %q, want %q", file.Cipher.Algorithm, CipherXChaCha20Poly1305)
+	}
+	if got := openEntry(t, path, "correct horse", "github"); got.Password != "s3cret" {
+		t.Errorf("password is %q, want s3cret", got.Password)
+	}
+
+	// The cipher is part of the authenticated header, so switching it back
+	// fails like a wrong password
+	tamper(t, path, func(f *VaultFile) { f.Cipher.Algorithm = CipherAES256GCM })
+	if _, err := Open(path, []byte("correct horse")); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Open with the cipher changed to %s returned %v, want %v", CipherAES256GCM, err, ErrInvalidPassword)
+	}
+	tamper(t, path, func(f *VaultFile) { f.Cipher.Algorithm = "chacha20-poly1305" })
+	if _, err := Open(path, []byte("correct horse")); err == nil || !strings.Contains(err.Error(), "chacha20-poly1305") {
+		t.Errorf("Open with an unknown cipher returned %v, want it refused", err)
+	}
+}
+
+func TestOpenTamperedKDFAlgorithm(t *testing.T) {
+	for i := range 2 {
+		path := newTestVault(t, "correct horse", "battery staple")
+		tamper(t, path, func(f *VaultFile) { f.KeySlots[i].KDF.Algorithm = "argon2i" })
+
+		_, err := Open(path, []byte("correct horse"))
+		if err == nil || !strings.Contains(err.Error(), "unsupported key derivation algorithm") {
+			t.Errorf("Open with slot %d using argon2i returned %v, want it refused", i, err)
+		}
+	}
+}
+
+func TestOpenUntampered(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	for _, pw := range []string{"correct horse", "battery staple"} {
+		session, err := Open(path, []byte(pw))
+		if err != nil {
+			t.Fatalf("Open with %q: %v", pw, err)
+		}
+		entry, err := session.Get("github")
+		session.Close()
+		if err != nil || entry.Password != "s3cret" {
+			t.Errorf("Get returned %+v, %v", entry, err)
+		}
+	}
+	if _, err := Open(path, []byte("wrong")); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Open with a wrong password returned %v, want %v", err, ErrInvalidPassword)
+	}
+}
+
+func TestAddEntryPrompts(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	script := NewScriptedPrompter("gitlab", "me@example.com", "gl-s3cret", "correct horse")
+	if err := newTestCLI(t, path, script).AddEntry(AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Entry name", "Enter username or secret description", "Enter secret", "Enter your master password"}
+	if !slices.Equal(script.Prompts, want) {
+		t.Errorf("AddEntry asked %q, want %q", script.Prompts, want)
+	}
+	if entry := openEntry(t, path, "correct horse", "gitlab"); entry.Username != "me@example.com" || entry.Password != "gl-s3cret" {
+		t.Errorf("added entry is %+v", entry)
+	}
+}
+
+func TestAddEntryExisting(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    AddOptions
+		answers []string
+		want    string
+		err     error
+	}{
+		{"declined", AddOptions{}, []string{"n"}, "s3cret", nil},
+		{"confirmed", AddOptions{}, []string{"y"}, "new", nil},
+		{"forced", AddOptions{Force: true}, nil, "new", nil},
+		{"no clobber", AddOptions{NoClobber: true}, nil, "s3cret", ErrEntryExists},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := newTestVault(t, "correct horse", "battery staple")
+			script := NewScriptedPrompter(append([]string{"correct horse"}, test.answers...)...)
+			opts := test.opts
+			opts.Name, opts.Username, opts.Secret = "github", "me", []byte("new")
+
+			if err := newTestCLI(t, path, script).AddEntry(opts); !errors.Is(err, test.err) {
+				t.Fatalf("AddEntry returned %v, want %v", err, test.err)
+			}
+			if len(script.Answers) > 0 {
+				t.Errorf("answers left unused: %q", script.Answers)
+			}
+			if got := openEntry(t, path, "correct horse", "github").Password; got != test.want {
+				t.Errorf("github password is %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEditEntryPrompts(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	// Empty answers keep the current values
+	script := NewScriptedPrompter("correct horse", "", "n3w-s3cret", "https://github.com", "", "work, code")
+	if err := newTestCLI(t, path, script).EditEntry("github", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Answers) > 0 {
+		t.Errorf("answers left unused: %q", script.Answers)
+	}
+
+	entry := openEntry(t, path, "correct horse", "github")
+	if entry.Username != "me" || entry.Password != "n3w-s3cret" ||
+		!slices.Equal(entry.URLs, []string{"https://github.com"}) || !slices.Equal(entry.Tags, []string{"work", "code"}) {
+		t.Errorf("edited entry is %+v", entry)
+	}
+}
+
+func TestEditEntrySets(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	script := NewScriptedPrompter("correct horse")
+	if err := newTestCLI(t, path, script).EditEntry("github", []string{"username=you"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Prompts) != 1 {
+		t.Errorf("EditEntry with assignments asked %q, want only the master password", script.Prompts)
+	}
+	if entry := openEntry(t, path, "correct horse", "github"); entry.Username != "you" || entry.Password != "s3cret" {
+		t.Errorf("edited entry is %+v", entry)
+	}
+
+	err := newTestCLI(t, path, NewScriptedPrompter("correct horse")).EditEntry("github", []string{"username"})
+	if err == nil {
+		t.Error("EditEntry accepted an assignment without a value")
+	}
+}
+
+func TestAccessEntry(t *testing.T) {
+	path := newTestVault(t, "correct horse", "battery staple")
+	backup := readFile(t, path+backupSuffix)
+	clock := now()
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return clock }
+
+	access := func() (stderr string) {
+		t.Helper()
+		var buf bytes.Buffer
+		v := newTestCLI(t, path, NewScriptedPrompter("correct horse"))
+		v.stderr = &buf
+		if _, err := v.accessEntry("github"); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	access()
+	if got := openEntry(t, path, "correct horse", "github").Accessed; !got.Equal(clock) {
+		t.Errorf("access time is %v, want %v", got, clock)
+	}
+	if readFile(t, path+backupSuffix) != backup {
+		t.Error("recording the access time replaced the backup")
+	}
+
+	// Within accessGranularity, reading leaves the vault alone
+	clock = clock.Add(accessGranularity / 2)
+	written := readFile(t, path)
+	access()
+	if readFile(t, path) != written {
+		t.Error("a second read within a minute rewrote the vault")
+	}
+
+	// A vault that cannot be written is read silently, other failures warn
+	clock = clock.Add(accessGranularity)
+	const warning = "Could not record the access time"
+	create := createTemp
+	createTemp = func(dir, pattern string) (*os.File, error) {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrPermission}
+	}
+	stderr := access()
+	createTemp = create
+	if strings.Contains(stderr, warning) {
+		t.Errorf("reading a read-only vault warned %q", stderr)
+	}
+	failAt(t, "rename")
+	if stderr := access(); !strings.Contains(stderr, warning) || !strings.Contains(stderr, errInjected.Error()) {
+		t.Errorf("a failed write warned %q, want the error", stderr)
+	}
+	if readFile(t, path) != written {
+		t.Error("failed writes changed the vault")
+	}
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//go:embed wordlist.txt
+var wordlistText string
+
+// wordlist holds 256 words, so each word encodes one byte of a recovery key
+// or escrow share. No two words share their first four letters, which is all
+// that needs to be typed.
+var wordlist = strings.Fields(wordlistText)
+
+//go:embed eff_large_wordlist.txt
+var passphraseText string
+
+// passphraseWords is the large wordlist of the Electronic Frontier Foundation,
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases,
+// licensed under CC BY 3.0 US. Its 7776 words add about 12.9 bits each to a
+// generated passphrase.
+var passphraseWords = strings.Fields(passphraseText)
+
+const (
+	// wordPrefix is the number of letters that identify a word
+	wordPrefix = 4
+	// wordGroupSize is the number of words shown on each numbered line
+	wordGroupSize = 3
+)
+
+// wordIndex maps every word and its unique prefix to its position in wordlist
+var wordIndex = func() map[string]byte {
+	index := make(map[string]byte, 2*len(wordlist))
+	for i, word := range wordlist {
+		index[word] = byte(i)
+		if len(word) > wordPrefix {
+			index[word[:wordPrefix]] = byte(i)
+		}
+	}
+	return index
+}()
+
+// encodeWords returns one word per byte of data
+func encodeWords(data []byte) []string {
+	words := make([]string, len(data))
+	for i, b := range data {
+		words[i] = wordlist[b]
+	}
+	return words
+}
+
+// decodeWords returns the bytes encoded by words, each given in full or by its
+// first four letters
+func decodeWords(words []string) ([]byte, error) {
+	data := make([]byte, len(words))
+	for i, word := range words {
+		b, ok := wordIndex[strings.ToLower(word)]
+		if !ok {
+			return nil, fmt.Errorf("unknown word %q", word)
+		}
+		data[i] = b
+	}
+	return data, nil
+}
+
+// splitWords splits text into words separated by spaces, dashes or commas,
+// ignoring line numbers as printed by numberedLines
+func splitWords(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-' || r == ','
+	})
+	var words []string
+	for _, field := range fields {
+		if strings.Trim(field, "0123456789.:") != "" {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// numberedLines groups words on numbered lines so they are easy to copy
+func numberedLines(words []string) []string {
+	var lines []string
+	for i := 0; i < len(words); i += wordGroupSize {
+		group := words[i:min(i+wordGroupSize, len(words))]
+		lines = append(lines, fmt.Sprintf("%d. %s", i/wordGroupSize+1, strings.Join(group, " ")))
+	}
+	return lines
+}